@@ -1,8 +1,13 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
@@ -11,14 +16,183 @@ import (
 
 // Config holds all the configuration for this service
 type Config struct {
-	Listen        string `envconfig:"HTTP_PORT" default:":8080"`
-	LogLevel      string `envconfig:"LOG_LEVEL" default:"debug"`
-	OriginHost    string `envconfig:"ORIGIN_HOST"`
-	PropellerHost string `envconfig:"PROPELLER_HOST"`
-	Hostname      string `envconfig:"HOSTNAME"  default:"localhost"`
+	Listen        string      `envconfig:"HTTP_PORT" default:":8080"`
+	LogLevel      string      `envconfig:"LOG_LEVEL" default:"debug"`
+	OriginHost    string      `envconfig:"ORIGIN_HOST"`
+	PropellerHost string      `envconfig:"PROPELLER_HOST"`
+	Hostname      string      `envconfig:"HOSTNAME"  default:"localhost"`
+	Codecs        Codecs      `envconfig:"CODECS"`
+	Presets       Presets     `envconfig:"PRESETS"`
+	DeviceRules   DeviceRules `envconfig:"DEVICE_RULES"`
 	Client        HTTPClient
 }
 
+// Codec maps a codec prefix to the content type it carries and the filter aliases
+// matching it
+type Codec struct {
+	Prefix      string
+	ContentType string
+	Aliases     []string
+}
+
+// Codecs are the codecs added to the built-in codec registry, decoded from a comma
+// separated list of prefix:contentType:alias|alias entries (e.g. av01:video:av1)
+type Codecs []Codec
+
+// Decode implements envconfig.Decoder
+func (c *Codecs) Decode(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+			return fmt.Errorf("codec %q is not formatted as prefix:contentType:alias|alias", entry)
+		}
+
+		switch parts[1] {
+		case "audio", "video", "text":
+		default:
+			return fmt.Errorf("codec %q has unknown content type %q", entry, parts[1])
+		}
+
+		codec := Codec{Prefix: parts[0], ContentType: parts[1]}
+		if len(parts) == 3 && parts[2] != "" {
+			codec.Aliases = strings.Split(parts[2], "|")
+		}
+
+		*c = append(*c, codec)
+	}
+
+	return nil
+}
+
+// Presets map preset names to the filter path they expand to, decoded from a semicolon
+// separated list of name=path entries (e.g. roku-legacy=/v(hevc,dvh)/b(0,6000)). Semicolons
+// within the values of a filter, as in b(video:500,6000;audio:64,256), are part of the path
+type Presets map[string]string
+
+// Decode implements envconfig.Decoder
+func (p *Presets) Decode(value string) error {
+	presets := Presets{}
+	for _, entry := range splitPresets(value) {
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("preset %q is not formatted as name=path", entry)
+		}
+
+		presets[parts[0]] = parts[1]
+	}
+
+	*p = presets
+	return nil
+}
+
+// splitPresets splits the preset entries on the semicolons outside of filter values
+func splitPresets(value string) []string {
+	var entries []string
+	var depth, start int
+	for i, c := range value {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ';' && depth == 0:
+			entries = append(entries, value[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(entries, value[start:])
+}
+
+// DeviceRule selects a filter preset for the requests whose headers all match the
+// given regular expressions
+type DeviceRule struct {
+	Name    string
+	Headers map[string]string
+	Preset  string
+
+	matchers map[string]*regexp.Regexp
+}
+
+// DeviceRules are the device rules, tried in order, decoded from a JSON list such as
+// [{"name":"roku","headers":{"User-Agent":"Roku"},"preset":"roku-legacy"}]
+type DeviceRules []DeviceRule
+
+// Decode implements envconfig.Decoder
+func (d *DeviceRules) Decode(value string) error {
+	var rules DeviceRules
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return fmt.Errorf("decoding device rules: %w", err)
+	}
+
+	for i, rule := range rules {
+		if rule.Name == "" || rule.Preset == "" || len(rule.Headers) == 0 {
+			return fmt.Errorf("device rule %q should have a name, a preset and headers", rule.Name)
+		}
+
+		rules[i].matchers = map[string]*regexp.Regexp{}
+		for header, pattern := range rule.Headers {
+			matcher, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("device rule %q: %w", rule.Name, err)
+			}
+
+			rules[i].matchers[http.CanonicalHeaderKey(header)] = matcher
+		}
+	}
+
+	*d = rules
+	return nil
+}
+
+// Match returns the first rule whose headers all match the request headers
+func (d DeviceRules) Match(header http.Header) (DeviceRule, bool) {
+	for _, rule := range d {
+		if rule.matches(header) {
+			return rule, true
+		}
+	}
+
+	return DeviceRule{}, false
+}
+
+func (r DeviceRule) matches(header http.Header) bool {
+	for name, matcher := range r.matchers {
+		values, found := header[name]
+		if !found || !matcher.MatchString(strings.Join(values, ", ")) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HeaderNames returns the sorted names of the headers the rules look at
+func (d DeviceRules) HeaderNames() []string {
+	unique := map[string]struct{}{}
+	for _, rule := range d {
+		for name := range rule.matchers {
+			unique[name] = struct{}{}
+		}
+	}
+
+	var names []string
+	for name := range unique {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
 // HTTPClient will issue requests to the manifest
 type HTTPClient struct {
 	Timeout time.Duration `envconfig:"CLIENT_TIMEOUT" default:"5s"`
@@ -37,9 +211,17 @@ func (h HTTPClient) New() *http.Client {
 // LoadConfig loads the configuration with environment variables injected
 func LoadConfig() (Config, error) {
 	var c Config
-	err := envconfig.Process("bakery", &c)
+	if err := envconfig.Process("bakery", &c); err != nil {
+		return c, err
+	}
+
+	for _, rule := range c.DeviceRules {
+		if _, found := c.Presets[rule.Preset]; !found {
+			return c, fmt.Errorf("device rule %q uses unknown preset %q", rule.Name, rule.Preset)
+		}
+	}
 
-	return c, err
+	return c, nil
 }
 
 // GetLogger generates a logger
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPresets_Decode(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		expectPresets Presets
+		expectErr     bool
+	}{
+		{
+			name:          "when several presets are given, they are decoded by name",
+			value:         "roku-legacy=/v(hevc,dvh)/b(0,6000);web=/v(dovi)",
+			expectPresets: Presets{"roku-legacy": "/v(hevc,dvh)/b(0,6000)", "web": "/v(dovi)"},
+		},
+		{
+			name:  "when a filter separates its values with semicolons, they are kept in the preset path",
+			value: "tv=/b(video:500,6000;audio:64,256);web=/v(dovi)",
+			expectPresets: Presets{
+				"tv":  "/b(video:500,6000;audio:64,256)",
+				"web": "/v(dovi)",
+			},
+		},
+		{
+			name:          "when the list ends with a semicolon, the empty entry is ignored",
+			value:         "web=/v(dovi);",
+			expectPresets: Presets{"web": "/v(dovi)"},
+		},
+		{
+			name:      "when an entry is not formatted as name=path, an error is returned",
+			value:     "web=/v(dovi);roku-legacy",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var presets Presets
+			err := presets.Decode(tt.value)
+			if err != nil && !tt.expectErr {
+				t.Errorf("Decode() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("Decode() expected an error, got nil")
+				return
+			}
+
+			if !tt.expectErr && !cmp.Equal(presets, tt.expectPresets) {
+				t.Errorf("Decode() wrong presets decoded\ngot %v\nexpected: %v", presets, tt.expectPresets)
+			}
+		})
+	}
+}
+
+func TestDeviceRules_Decode(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expectNames []string
+		expectErr   bool
+	}{
+		{
+			name:        "when the rules are valid, they are decoded in order",
+			value:       `[{"name":"roku","headers":{"User-Agent":"Roku"},"preset":"roku-legacy"},{"name":"tv","headers":{"sec-ch-ua-platform":"Tizen"},"preset":"tv"}]`,
+			expectNames: []string{"roku", "tv"},
+		},
+		{
+			name:      "when the value is not JSON, an error is returned",
+			value:     `roku=roku-legacy`,
+			expectErr: true,
+		},
+		{
+			name:      "when a rule has no preset, an error is returned",
+			value:     `[{"name":"roku","headers":{"User-Agent":"Roku"}}]`,
+			expectErr: true,
+		},
+		{
+			name:      "when a rule has no headers, an error is returned",
+			value:     `[{"name":"roku","preset":"roku-legacy"}]`,
+			expectErr: true,
+		},
+		{
+			name:      "when a header pattern is not a regular expression, an error is returned",
+			value:     `[{"name":"roku","headers":{"User-Agent":"Roku("},"preset":"roku-legacy"}]`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var rules DeviceRules
+			err := rules.Decode(tt.value)
+			if err != nil && !tt.expectErr {
+				t.Errorf("Decode() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("Decode() expected an error, got nil")
+				return
+			}
+
+			var names []string
+			for _, rule := range rules {
+				names = append(names, rule.Name)
+			}
+
+			if !cmp.Equal(names, tt.expectNames) {
+				t.Errorf("Decode() wrong rules decoded\ngot %v\nexpected: %v", names, tt.expectNames)
+			}
+		})
+	}
+}
+
+func TestDeviceRules_Match(t *testing.T) {
+	var rules DeviceRules
+	err := rules.Decode(`[
+		{"name":"roku-4k","headers":{"User-Agent":"Roku","sec-ch-ua-model":"4K"},"preset":"roku-4k"},
+		{"name":"roku","headers":{"user-agent":"^Roku/"},"preset":"roku-legacy"},
+		{"name":"any-roku","headers":{"User-Agent":"Roku"},"preset":"roku-any"}
+	]`)
+	if err != nil {
+		t.Fatalf("Decode() didnt expect an error to be returned, got: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		header        http.Header
+		expectRule    string
+		expectMatched bool
+	}{
+		{
+			name:          "when every header of a rule matches, the rule is returned",
+			header:        http.Header{"User-Agent": {"Roku/DVP-9.10"}, "Sec-Ch-Ua-Model": {"Ultra 4K"}},
+			expectRule:    "roku-4k",
+			expectMatched: true,
+		},
+		{
+			name:          "when several rules match, the first one is returned",
+			header:        http.Header{"User-Agent": {"Roku/DVP-9.10"}},
+			expectRule:    "roku",
+			expectMatched: true,
+		},
+		{
+			name:          "when only some headers of a rule match, the next rules are tried",
+			header:        http.Header{"User-Agent": {"Mozilla/5.0 Roku"}, "Sec-Ch-Ua-Model": {"Express"}},
+			expectRule:    "any-roku",
+			expectMatched: true,
+		},
+		{
+			name:   "when no rule matches, no rule is returned",
+			header: http.Header{"User-Agent": {"Mozilla/5.0"}},
+		},
+		{
+			name:   "when the headers are missing, no rule is returned",
+			header: http.Header{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rule, matched := rules.Match(tt.header)
+			if matched != tt.expectMatched {
+				t.Errorf("Match() wrong match returned, got %v, expected %v", matched, tt.expectMatched)
+			}
+
+			if rule.Name != tt.expectRule {
+				t.Errorf("Match() wrong rule returned, got %q, expected %q", rule.Name, tt.expectRule)
+			}
+		})
+	}
+}
+
+func TestDeviceRules_HeaderNames(t *testing.T) {
+	var rules DeviceRules
+	err := rules.Decode(`[
+		{"name":"tv","headers":{"user-agent":"Tizen","sec-ch-ua-platform":"Tizen"},"preset":"tv"},
+		{"name":"roku","headers":{"User-Agent":"Roku"},"preset":"roku-legacy"}
+	]`)
+	if err != nil {
+		t.Fatalf("Decode() didnt expect an error to be returned, got: %v", err)
+	}
+
+	expected := []string{"Sec-Ch-Ua-Platform", "User-Agent"}
+	if names := rules.HeaderNames(); !cmp.Equal(names, expected) {
+		t.Errorf("HeaderNames() wrong names returned\ngot %v\nexpected: %v", names, expected)
+	}
+}
+
+func TestLoadConfig_deviceRulePresets(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     string
+		expectErr bool
+	}{
+		{
+			name:  "when the device rules use configured presets, the config is loaded",
+			rules: `[{"name":"roku","headers":{"User-Agent":"Roku"},"preset":"roku-legacy"}]`,
+		},
+		{
+			name:      "when a device rule uses an unknown preset, an error is returned",
+			rules:     `[{"name":"roku","headers":{"User-Agent":"Roku"},"preset":"roku-4k"}]`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("BAKERY_PRESETS", "roku-legacy=/v(hevc)")
+			os.Setenv("BAKERY_DEVICE_RULES", tt.rules)
+			defer os.Unsetenv("BAKERY_PRESETS")
+			defer os.Unsetenv("BAKERY_DEVICE_RULES")
+
+			_, err := LoadConfig()
+			if err != nil && !tt.expectErr {
+				t.Errorf("LoadConfig() didnt expect an error to be returned, got: %v", err)
+			} else if err == nil && tt.expectErr {
+				t.Error("LoadConfig() expected an error, got nil")
+			}
+		})
+	}
+}
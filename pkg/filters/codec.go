@@ -0,0 +1,286 @@
+package filters
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cbsinteractive/bakery/pkg/config"
+	"github.com/cbsinteractive/bakery/pkg/parsers"
+)
+
+// CodecFamily is the family a codec string belongs to, regardless of its sample entry
+type CodecFamily string
+
+const (
+	avcFamily   CodecFamily = "avc"
+	hevcFamily  CodecFamily = "hevc"
+	doviFamily  CodecFamily = "dovi"
+	otherFamily CodecFamily = ""
+)
+
+// codecFamilies maps the sample entries of the video codecs we can parse to their family
+var codecFamilies = map[string]CodecFamily{
+	"avc1": avcFamily,
+	"avc3": avcFamily,
+	"hvc1": hevcFamily,
+	"hev1": hevcFamily,
+	"dvh1": doviFamily,
+	"dvhe": doviFamily,
+	"dva1": doviFamily,
+	"dvav": doviFamily,
+}
+
+// Codec is an RFC 6381 codec string broken down into its parts
+type Codec struct {
+	SampleEntry string
+	Family      CodecFamily
+	Profile     int
+	Tier        string
+	Level       float64
+}
+
+// ParseCodec breaks down a codec string such as avc1.64001f, hvc1.2.4.L153.B0 or
+// dvh1.05.06. Codecs of other families only carry their sample entry
+func ParseCodec(codec string) (Codec, error) {
+	parts := strings.Split(strings.TrimSpace(codec), ".")
+	c := Codec{SampleEntry: parts[0], Family: codecFamilies[parts[0]]}
+
+	var err error
+	switch c.Family {
+	case avcFamily:
+		err = c.parseAVC(parts[1:])
+	case hevcFamily:
+		err = c.parseHEVC(parts[1:])
+	case doviFamily:
+		err = c.parseDolbyVision(parts[1:])
+	}
+
+	if err != nil {
+		return Codec{}, fmt.Errorf("parsing codec %q: %w", codec, err)
+	}
+
+	return c, nil
+}
+
+// parseAVC reads the avc1.PPCCLL format, where the profile, constraints and level are
+// hexadecimal, along with the legacy avc1.PROFILE.LEVEL decimal format
+func (c *Codec) parseAVC(parts []string) error {
+	switch {
+	case len(parts) == 1 && len(parts[0]) == 6:
+		profile, err := strconv.ParseUint(parts[0][0:2], 16, 8)
+		if err != nil {
+			return err
+		}
+
+		level, err := strconv.ParseUint(parts[0][4:6], 16, 8)
+		if err != nil {
+			return err
+		}
+
+		c.Profile, c.Level = int(profile), float64(level)/10
+	case len(parts) == 2:
+		profile, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return err
+		}
+
+		level, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return err
+		}
+
+		c.Profile, c.Level = profile, float64(level)/10
+	default:
+		return fmt.Errorf("expected profile and level")
+	}
+
+	return nil
+}
+
+// parseHEVC reads the hvc1.PROFILE.COMPATIBILITY.TIERLEVEL.CONSTRAINTS format, where the
+// profile may be prefixed with its profile space and the level is 30 times the level number
+func (c *Codec) parseHEVC(parts []string) error {
+	if len(parts) < 3 {
+		return fmt.Errorf("expected profile, compatibility flags and tier and level")
+	}
+
+	profile, err := strconv.Atoi(strings.TrimLeft(parts[0], "ABC"))
+	if err != nil {
+		return err
+	}
+
+	tierLevel := parts[2]
+	switch {
+	case strings.HasPrefix(tierLevel, "L"):
+		c.Tier = "main"
+	case strings.HasPrefix(tierLevel, "H"):
+		c.Tier = "high"
+	default:
+		return fmt.Errorf("unknown tier in %q", tierLevel)
+	}
+
+	level, err := strconv.Atoi(tierLevel[1:])
+	if err != nil {
+		return err
+	}
+
+	c.Profile, c.Level = profile, float64(level)/30
+	return nil
+}
+
+// parseDolbyVision reads the dvh1.PROFILE.LEVEL format
+func (c *Codec) parseDolbyVision(parts []string) error {
+	if len(parts) < 2 {
+		return fmt.Errorf("expected profile and level")
+	}
+
+	profile, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return err
+	}
+
+	level, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return err
+	}
+
+	c.Profile, c.Level = profile, float64(level)
+	return nil
+}
+
+// Returns true if the codec level is above the maximum level set for its family. Codecs
+// that can't be parsed are never above the maximum level
+func exceedsVideoLevel(codec string, levels []parsers.VideoLevel) bool {
+	c, err := ParseCodec(codec)
+	if err != nil || c.Family == otherFamily {
+		return false
+	}
+
+	for _, level := range levels {
+		// levels are compared with a tolerance as HEVC levels are stored as a multiple of 1/30
+		if CodecFamily(level.Codec) == c.Family && c.Level > level.Level+0.001 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// builtInCodecs are the codecs known to the codec registry before the configured ones
+var builtInCodecs = config.Codecs{
+	{Prefix: "avc1", ContentType: string(videoContentType), Aliases: []string{"avc"}},
+	{Prefix: "avc3", ContentType: string(videoContentType), Aliases: []string{"avc"}},
+	{Prefix: "hvc1", ContentType: string(videoContentType), Aliases: []string{"hevc", "hvc"}},
+	{Prefix: "hev1", ContentType: string(videoContentType), Aliases: []string{"hevc", "hev"}},
+	{Prefix: "dvh1", ContentType: string(videoContentType), Aliases: []string{"dovi", "dvh"}},
+	{Prefix: "dvhe", ContentType: string(videoContentType), Aliases: []string{"dovi", "dvh"}},
+	{Prefix: "dva1", ContentType: string(videoContentType), Aliases: []string{"dovi"}},
+	{Prefix: "dvav", ContentType: string(videoContentType), Aliases: []string{"dovi"}},
+	{Prefix: "av01", ContentType: string(videoContentType), Aliases: []string{"av1"}},
+	{Prefix: "vp09", ContentType: string(videoContentType), Aliases: []string{"vp9"}},
+	{Prefix: "mp4a", ContentType: string(audioContentType), Aliases: []string{"aac"}},
+	{Prefix: "mp4a.40.2", ContentType: string(audioContentType), Aliases: []string{"aac-lc"}},
+	{Prefix: "mp4a.40.5", ContentType: string(audioContentType), Aliases: []string{"he-aac"}},
+	{Prefix: "mp4a.40.29", ContentType: string(audioContentType), Aliases: []string{"he-aacv2"}},
+	{Prefix: "ac-3", ContentType: string(audioContentType)},
+	{Prefix: "ec-3", ContentType: string(audioContentType)},
+	{Prefix: "ac-4", ContentType: string(audioContentType)},
+	{Prefix: "opus", ContentType: string(audioContentType)},
+	{Prefix: "flac", ContentType: string(audioContentType)},
+	{Prefix: "stpp", ContentType: string(captionContentType)},
+	{Prefix: "stpp.ttml.im1t", ContentType: string(captionContentType), Aliases: []string{"imsc-text"}},
+	{Prefix: "stpp.ttml.im1i", ContentType: string(captionContentType), Aliases: []string{"imsc-image"}},
+	{Prefix: "wvtt", ContentType: string(captionContentType)},
+}
+
+// CodecRegistry maps codec prefixes to the content type they carry and the filter
+// aliases matching them
+type CodecRegistry struct {
+	codecs   config.Codecs
+	matchers map[ContentType]func(string) bool
+}
+
+// NewCodecRegistry is the codec registry constructor. The configured codecs are added
+// to the built-in ones, overriding those with the same prefix
+func NewCodecRegistry(configured config.Codecs) *CodecRegistry {
+	codecs := append(config.Codecs{}, builtInCodecs...)
+	r := &CodecRegistry{codecs: append(codecs, configured...)}
+	r.matchers = map[ContentType]func(string) bool{
+		audioContentType:   r.isContentType(audioContentType),
+		videoContentType:   r.isContentType(videoContentType),
+		captionContentType: r.isContentType(captionContentType),
+	}
+
+	return r
+}
+
+// lookup returns the registered codecs the codec string starts with, up to a dot and
+// compared without case as in fLaC
+func (r *CodecRegistry) lookup(codec string) []config.Codec {
+	codec = strings.ToLower(strings.TrimSpace(codec))
+
+	var found []config.Codec
+	for _, c := range r.codecs {
+		if hasCodecPrefix(codec, strings.ToLower(c.Prefix)) {
+			found = append(found, c)
+		}
+	}
+
+	return found
+}
+
+// ContentType returns the content type of the longest registered prefix of the codec
+func (r *CodecRegistry) ContentType(codec string) (ContentType, bool) {
+	var longest *config.Codec
+	for _, c := range r.lookup(codec) {
+		c := c
+		if longest == nil || len(c.Prefix) >= len(longest.Prefix) {
+			longest = &c
+		}
+	}
+
+	if longest == nil {
+		return "", false
+	}
+
+	return ContentType(longest.ContentType), true
+}
+
+// Matches returns true if the filter value matches the codec, either as a prefix of the
+// codec string or as one of its registered prefixes or their aliases
+func (r *CodecRegistry) Matches(codec, filter string) bool {
+	if filter == "" {
+		return false
+	}
+
+	if ValidCodecs(codec, CodecFilterID(filter)) {
+		return true
+	}
+
+	for _, c := range r.lookup(codec) {
+		if strings.EqualFold(c.Prefix, filter) {
+			return true
+		}
+
+		for _, alias := range c.Aliases {
+			if strings.EqualFold(alias, filter) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchFunctions returns, for each content type, a function telling if a codec carries it
+func (r *CodecRegistry) matchFunctions() map[ContentType]func(string) bool {
+	return r.matchers
+}
+
+func (r *CodecRegistry) isContentType(ct ContentType) func(string) bool {
+	return func(codec string) bool {
+		codecContentType, found := r.ContentType(codec)
+		return found && codecContentType == ct
+	}
+}
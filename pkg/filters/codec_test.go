@@ -0,0 +1,206 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/cbsinteractive/bakery/pkg/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseCodec(t *testing.T) {
+	tests := []struct {
+		name        string
+		codec       string
+		expectCodec Codec
+		expectErr   bool
+	}{
+		{
+			name:        "avc codec string with hexadecimal profile and level",
+			codec:       "avc1.64001f",
+			expectCodec: Codec{SampleEntry: "avc1", Family: avcFamily, Profile: 100, Level: 3.1},
+		},
+		{
+			name:        "avc codec string with legacy decimal profile and level",
+			codec:       "avc1.66.30",
+			expectCodec: Codec{SampleEntry: "avc1", Family: avcFamily, Profile: 66, Level: 3},
+		},
+		{
+			name:        "hevc codec string with main tier",
+			codec:       "hvc1.2.4.L153.B0",
+			expectCodec: Codec{SampleEntry: "hvc1", Family: hevcFamily, Profile: 2, Tier: "main", Level: 5.1},
+		},
+		{
+			name:        "hevc codec string with profile space and high tier",
+			codec:       "hev1.A1.60000000.H120.90",
+			expectCodec: Codec{SampleEntry: "hev1", Family: hevcFamily, Profile: 1, Tier: "high", Level: 4},
+		},
+		{
+			name:        "dolby vision codec string",
+			codec:       "dvh1.05.06",
+			expectCodec: Codec{SampleEntry: "dvh1", Family: doviFamily, Profile: 5, Level: 6},
+		},
+		{
+			name:        "codec string of another family only carries its sample entry",
+			codec:       " mp4a.40.2",
+			expectCodec: Codec{SampleEntry: "mp4a"},
+		},
+		{
+			name:      "avc codec string without level returns an error",
+			codec:     "avc1",
+			expectErr: true,
+		},
+		{
+			name:      "hevc codec string with an unknown tier returns an error",
+			codec:     "hvc1.2.4.X153",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			codec, err := ParseCodec(tt.codec)
+			if err != nil && !tt.expectErr {
+				t.Errorf("ParseCodec() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("ParseCodec() expected an error, got nil")
+				return
+			}
+
+			if !cmp.Equal(codec, tt.expectCodec, cmp.Comparer(func(x, y float64) bool {
+				return x-y < 0.001 && y-x < 0.001
+			})) {
+				t.Errorf("ParseCodec() wrong codec returned\ngot %+v\nexpected: %+v", codec, tt.expectCodec)
+			}
+		})
+	}
+}
+
+func TestCodecRegistry(t *testing.T) {
+	registry := NewCodecRegistry(config.Codecs{
+		{Prefix: "vvc1", ContentType: "video", Aliases: []string{"vvc"}},
+		{Prefix: "ac-4", ContentType: "audio", Aliases: []string{"dolby-ac4"}},
+	})
+
+	tests := []struct {
+		name              string
+		codec             string
+		filter            string
+		expectContentType ContentType
+		expectMatch       bool
+	}{
+		{
+			name:              "built-in codec matches its alias",
+			codec:             "av01.0.08M.10",
+			filter:            "av1",
+			expectContentType: videoContentType,
+			expectMatch:       true,
+		},
+		{
+			name:              "built-in codec matches a prefix of its codec string",
+			codec:             "mp4a.40.2",
+			filter:            "mp4a.40",
+			expectContentType: audioContentType,
+			expectMatch:       true,
+		},
+		{
+			name:              "prefix of a codec string only matches up to a dot",
+			codec:             "avc1.64001f",
+			filter:            "avc1.64",
+			expectContentType: videoContentType,
+		},
+		{
+			name:              "AAC-LC prefix does not match HE-AACv2",
+			codec:             "mp4a.40.29",
+			filter:            "mp4a.40.2",
+			expectContentType: audioContentType,
+		},
+		{
+			name:              "AAC-LC alias does not match HE-AACv2",
+			codec:             "mp4a.40.29",
+			filter:            "aac-lc",
+			expectContentType: audioContentType,
+		},
+		{
+			name:              "HE-AACv2 alias matches its own object type",
+			codec:             "mp4a.40.29",
+			filter:            "he-aacv2",
+			expectContentType: audioContentType,
+			expectMatch:       true,
+		},
+		{
+			name:              "AAC-LC alias does not match HE-AAC",
+			codec:             "mp4a.40.5",
+			filter:            "aac-lc",
+			expectContentType: audioContentType,
+		},
+		{
+			name:              "HE-AAC alias matches its own object type",
+			codec:             "mp4a.40.5",
+			filter:            "he-aac",
+			expectContentType: audioContentType,
+			expectMatch:       true,
+		},
+		{
+			name:              "codec string containing the filter without starting with it does not match",
+			codec:             "mp4a.40.2",
+			filter:            "40",
+			expectContentType: audioContentType,
+		},
+		{
+			name:              "audio object type alias only matches its own object type",
+			codec:             "mp4a.40.2",
+			filter:            "he-aac",
+			expectContentType: audioContentType,
+		},
+		{
+			name:              "family alias matches every audio object type",
+			codec:             "mp4a.40.5",
+			filter:            "aac",
+			expectContentType: audioContentType,
+			expectMatch:       true,
+		},
+		{
+			name:              "codec prefixes are compared without case",
+			codec:             "fLaC",
+			filter:            "flac",
+			expectContentType: audioContentType,
+			expectMatch:       true,
+		},
+		{
+			name:              "image captions match their alias",
+			codec:             "stpp.ttml.im1i",
+			filter:            "imsc-image",
+			expectContentType: captionContentType,
+			expectMatch:       true,
+		},
+		{
+			name:              "configured codec is known to the registry",
+			codec:             "vvc1.1.L51.CQA",
+			filter:            "vvc",
+			expectContentType: videoContentType,
+			expectMatch:       true,
+		},
+		{
+			name:              "configured alias is added to a built-in codec",
+			codec:             "ac-4.02.01.01",
+			filter:            "dolby-ac4",
+			expectContentType: audioContentType,
+			expectMatch:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if ct, _ := registry.ContentType(tt.codec); ct != tt.expectContentType {
+				t.Errorf("ContentType() wrong content type returned, got %q, expected %q", ct, tt.expectContentType)
+			}
+
+			if match := registry.Matches(tt.codec, tt.filter); match != tt.expectMatch {
+				t.Errorf("Matches() wrong match returned, got %v, expected %v", match, tt.expectMatch)
+			}
+		})
+	}
+}
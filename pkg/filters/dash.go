@@ -2,10 +2,13 @@ package filters
 
 import (
 	"fmt"
+	"math"
+	"math/bits"
 	"net/url"
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cbsinteractive/bakery/pkg/config"
 	"github.com/cbsinteractive/bakery/pkg/parsers"
@@ -14,11 +17,48 @@ import (
 
 type execFilter func(filters *parsers.MediaFilters, manifest *mpd.MPD)
 
+const (
+	audioPurposeSchemeIDURI = "urn:tva:metadata:cs:AudioPurposeCS:2007"
+	descriptionRoleValue    = "description"
+	trickModeSchemeIDURI    = "http://dashif.org/guidelines/trickmode"
+
+	transferCharacteristicsSchemeIDURI = "urn:mpeg:mpegB:cicp:TransferCharacteristics"
+)
+
+// AudioChannelConfiguration schemes
+const (
+	channelCountSchemeIDURI       = "urn:mpeg:dash:23003:3:audio_channel_configuration:2011"
+	cicpChannelSchemeIDURI        = "urn:mpeg:mpegB:cicp:ChannelConfiguration"
+	dolbyChannelSchemeIDURI       = "tag:dolby.com,2014:dash:audio_channel_configuration:2011"
+	legacyDolbyChannelSchemeIDURI = "urn:dolby:dash:audio_channel_configuration:2011"
+)
+
+// cicpChannelCounts maps the ChannelConfiguration values of ISO/IEC 23091-3 to the
+// number of channels they carry
+var cicpChannelCounts = map[string]int{
+	"1": 1, "2": 2, "3": 3, "4": 4, "5": 5, "6": 6, "7": 8, "9": 3, "10": 4, "11": 7,
+	"12": 8, "13": 24, "14": 8, "15": 12, "16": 10, "17": 12, "18": 14, "19": 12, "20": 14,
+}
+
+// dolbyChannelPairs are the bits of the Dolby channel configuration mask that stand for
+// a pair of channels (Lc/Rc, Lrs/Rrs, Lsd/Rsd, Lw/Rw, Vhl/Vhr and Lts/Rts)
+var dolbyChannelPairs = []uint{10, 9, 6, 5, 4, 2}
+
+// transferCharacteristicsVideoRanges maps the CICP transfer characteristics to the HDR
+// video ranges, any other transfer characteristics being SDR
+var transferCharacteristicsVideoRanges = map[string]parsers.VideoRange{
+	"16": pqVideoRange,
+	"18": hlgVideoRange,
+}
+
 // DASHFilter implements the Filter interface for DASH manifests
 type DASHFilter struct {
 	manifestURL     string
 	manifestContent string
 	config          config.Config
+	codecs          *CodecRegistry
+	descriptors     descriptors
+	usedFallback    bool
 }
 
 // NewDASHFilter is the DASH filter constructor
@@ -27,15 +67,17 @@ func NewDASHFilter(manifestURL, manifestContent string, c config.Config) *DASHFi
 		manifestURL:     manifestURL,
 		manifestContent: manifestContent,
 		config:          c,
+		codecs:          NewCodecRegistry(c.Codecs),
 	}
 }
 
 // FilterManifest will be responsible for filtering the manifest according  to the MediaFilters
 func (d *DASHFilter) FilterManifest(filters *parsers.MediaFilters) (string, error) {
-	manifest, err := mpd.ReadFromString(d.manifestContent)
+	manifest, found, err := readManifest(d.manifestContent)
 	if err != nil {
 		return "", err
 	}
+	d.descriptors = found
 
 	u, err := url.Parse(d.manifestURL)
 	if err != nil {
@@ -58,9 +100,38 @@ func (d *DASHFilter) FilterManifest(filters *parsers.MediaFilters) (string, erro
 		manifest.BaseURL = baseURLWithPath(path.Join(path.Dir(u.Path), manifest.BaseURL))
 	}
 
+	originalIDs := adaptationSetIDs(manifest)
+	playablePeriods := map[*mpd.Period]int{}
+	for i, period := range manifest.Periods {
+		if d.isPlayablePeriod(period) {
+			playablePeriods[period] = i
+		}
+	}
+
 	for _, filter := range d.getFilters(filters) {
 		filter(filters, manifest)
 	}
+	d.filterTrickModeReferences(originalIDs, manifest)
+
+	d.usedFallback = false
+	if d.emptiedPlayablePeriods(playablePeriods, manifest) {
+		// without a policy, the manifest is served as the filters left it
+		switch filters.EmptyPolicy {
+		case parsers.EmptyPolicyError:
+			return "", ErrNoPlayableVariant
+		case parsers.EmptyPolicyFallback:
+			if err := d.fallbackPeriods(filters, playablePeriods, manifest); err != nil {
+				return "", err
+			}
+			d.usedFallback = true
+		}
+	}
+
+	if filters.Trim != nil {
+		if err := trimManifest(filters.Trim, manifest); err != nil {
+			return "", err
+		}
+	}
 
 	for _, plugin := range filters.Plugins {
 		if exec, ok := pluginDASH[plugin]; ok {
@@ -68,7 +139,169 @@ func (d *DASHFilter) FilterManifest(filters *parsers.MediaFilters) (string, erro
 		}
 	}
 
-	return manifest.WriteToString()
+	return writeManifest(manifest, d.descriptors)
+}
+
+// UsedFallback returns true if the last filtered manifest was served with fallback
+// representations, as the filters removed every playable one of a period
+func (d *DASHFilter) UsedFallback() bool {
+	return d.usedFallback
+}
+
+// isPlayablePeriod returns true if the period has an audio or video representation
+// outside of the trick mode adaptation sets
+func (d *DASHFilter) isPlayablePeriod(period *mpd.Period) bool {
+	for _, as := range period.AdaptationSets {
+		if d.trickModeReference(as) != nil {
+			continue
+		}
+
+		for _, r := range as.Representations {
+			if ct := representationContentType(as, r); ct == videoContentType || ct == audioContentType {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// emptiedPlayablePeriods returns true if the filters removed every playable period, or
+// left one of the remaining playable periods without any audio or video representation
+func (d *DASHFilter) emptiedPlayablePeriods(playablePeriods map[*mpd.Period]int, manifest *mpd.MPD) bool {
+	if len(playablePeriods) == 0 {
+		return false
+	}
+
+	var remaining bool
+	for _, period := range manifest.Periods {
+		if _, found := playablePeriods[period]; !found {
+			continue
+		}
+
+		if !d.isPlayablePeriod(period) {
+			return true
+		}
+		remaining = true
+	}
+
+	return !remaining
+}
+
+// fallbackPeriods replaces the periods the filters emptied with their origin period
+// narrowed down to the representations closest to the filters. When no playable period
+// is left, every playable period of the origin is served this way
+func (d *DASHFilter) fallbackPeriods(filters *parsers.MediaFilters, playablePeriods map[*mpd.Period]int, manifest *mpd.MPD) error {
+	origin, found, err := readManifest(d.manifestContent)
+	if err != nil {
+		return err
+	}
+
+	for parent, elements := range found {
+		d.descriptors[parent] = elements
+	}
+
+	var remaining bool
+	for i, period := range manifest.Periods {
+		index, found := playablePeriods[period]
+		if !found {
+			continue
+		}
+
+		if d.isPlayablePeriod(period) {
+			remaining = true
+			continue
+		}
+
+		fallback := d.fallbackPeriod(filters, origin.Periods[index])
+		fallback.ID = period.ID
+		manifest.Periods[i] = fallback
+		remaining = true
+	}
+
+	if !remaining {
+		var fallbackPeriods []*mpd.Period
+		for _, period := range origin.Periods {
+			if d.isPlayablePeriod(period) {
+				fallbackPeriods = append(fallbackPeriods, d.fallbackPeriod(filters, period))
+			}
+		}
+		manifest.Periods = fallbackPeriods
+	}
+
+	return nil
+}
+
+// fallbackPeriod keeps, for both video and audio, the representation whose bandwidth is
+// the closest to the bitrate filters in its own adaptation set. The lowest bandwidth wins
+// ties, so that the representations most likely to play are kept when no bitrate is given
+func (d *DASHFilter) fallbackPeriod(filters *parsers.MediaFilters, period *mpd.Period) *mpd.Period {
+	closest := map[ContentType]*mpd.Representation{}
+	closestDistance := map[ContentType]int{}
+	for _, as := range period.AdaptationSets {
+		if d.trickModeReference(as) != nil {
+			continue
+		}
+
+		for _, r := range as.Representations {
+			ct := representationContentType(as, r)
+			if ct != videoContentType && ct != audioContentType {
+				continue
+			}
+
+			distance := bitrateDistance(filters, ct, r)
+			current, found := closest[ct]
+			if !found || distance < closestDistance[ct] ||
+				(distance == closestDistance[ct] && representationBandwidth(r) < representationBandwidth(current)) {
+				closest[ct], closestDistance[ct] = r, distance
+			}
+		}
+	}
+
+	var fallbackAdaptationSets []*mpd.AdaptationSet
+	for _, as := range period.AdaptationSets {
+		for _, r := range as.Representations {
+			if closest[representationContentType(as, r)] == r {
+				as.Representations = []*mpd.Representation{r}
+				as.ID = strptr(strconv.Itoa(len(fallbackAdaptationSets)))
+				fallbackAdaptationSets = append(fallbackAdaptationSets, as)
+				break
+			}
+		}
+	}
+	period.AdaptationSets = fallbackAdaptationSets
+
+	return period
+}
+
+// bitrateDistance returns how far the representation bandwidth is from the bitrate
+// ranges of the filters, 0 meaning the representation is within them
+func bitrateDistance(filters *parsers.MediaFilters, ct ContentType, r *mpd.Representation) int {
+	bandwidth := int(representationBandwidth(r))
+
+	var distance int
+	if ct == videoContentType && filters.DefinesBitrateFilter() {
+		overall := parsers.BitrateRange{Min: filters.MinBitrate, Max: filters.MaxBitrate}
+		distance = overall.Distance(bandwidth)
+	}
+
+	switch {
+	case ct == videoContentType && filters.VideoBitrate != nil:
+		distance += filters.VideoBitrate.Distance(bandwidth)
+	case ct == audioContentType && filters.AudioBitrate != nil:
+		distance += filters.AudioBitrate.Distance(bandwidth)
+	}
+
+	return distance
+}
+
+// Returns the bandwidth of the representation, 0 when it does not advertise one
+func representationBandwidth(r *mpd.Representation) int64 {
+	if r.Bandwidth == nil {
+		return 0
+	}
+
+	return *r.Bandwidth
 }
 
 func (d *DASHFilter) getFilters(filters *parsers.MediaFilters) []execFilter {
@@ -77,53 +310,222 @@ func (d *DASHFilter) getFilters(filters *parsers.MediaFilters) []execFilter {
 		filterList = append(filterList, d.filterAdaptationSetType)
 	}
 
-	if filters.DefinesBitrateFilter() {
+	if filters.DefinesBitrateFilter() || filters.VideoBitrate != nil || filters.AudioBitrate != nil {
 		filterList = append(filterList, d.filterBandwidth)
 	}
 
-	if filters.Videos != nil {
+	if filters.Resolution != nil {
+		filterList = append(filterList, d.filterResolution)
+	}
+
+	if filters.FrameRate != nil {
+		filterList = append(filterList, d.filterFrameRate)
+	}
+
+	if filters.VideoRanges != nil {
+		filterList = append(filterList, d.filterVideoRanges)
+	}
+
+	if filters.VideoLevels != nil {
+		filterList = append(filterList, d.filterVideoLevels)
+	}
+
+	if filters.Videos != nil || filters.KeepVideos != nil {
 		filterList = append(filterList, d.filterVideoTypes)
 	}
 
-	if filters.Audios != nil {
+	if filters.Audios != nil || filters.KeepAudios != nil {
 		filterList = append(filterList, d.filterAudioTypes)
 	}
 
-	if filters.CaptionTypes != nil {
+	if filters.CaptionTypes != nil || filters.KeepCaptionTypes != nil {
 		filterList = append(filterList, d.filterCaptionTypes)
 	}
 
+	if filters.AudioChannels != nil {
+		filterList = append(filterList, d.filterAudioChannels)
+	}
+
+	if filters.AudioLanguages != nil || filters.KeepAudioLanguages != nil {
+		filterList = append(filterList, d.filterAudioLanguages)
+	}
+
+	if filters.DefinesAudioDescriptionFilter() {
+		filterList = append(filterList, d.filterAudioDescription)
+	}
+
+	if filters.CaptionLanguages != nil || filters.KeepCaptionLanguages != nil {
+		filterList = append(filterList, d.filterCaptionLanguages)
+	}
+
+	if filters.LadderSize != nil {
+		filterList = append(filterList, d.filterLadderSize)
+	}
+
 	return filterList
 }
 
 func (d *DASHFilter) filterVideoTypes(filters *parsers.MediaFilters, manifest *mpd.MPD) {
-	supportedVideoTypes := map[string]struct{}{}
-	for _, videoType := range filters.Videos {
-		supportedVideoTypes[string(videoType)] = struct{}{}
+	if filters.Videos != nil {
+		supportedVideoTypes := map[string]struct{}{}
+		for _, videoType := range filters.Videos {
+			supportedVideoTypes[string(videoType)] = struct{}{}
+		}
+
+		filterContentType(videoContentType, supportedVideoTypes, false, d.codecs, manifest)
 	}
 
-	filterContentType(videoContentType, supportedVideoTypes, manifest)
+	if filters.KeepVideos != nil {
+		keptVideoTypes := map[string]struct{}{}
+		for _, videoType := range filters.KeepVideos {
+			keptVideoTypes[string(videoType)] = struct{}{}
+		}
+
+		filterContentType(videoContentType, keptVideoTypes, true, d.codecs, manifest)
+	}
 }
 
 func (d *DASHFilter) filterAudioTypes(filters *parsers.MediaFilters, manifest *mpd.MPD) {
-	supportedAudioTypes := map[string]struct{}{}
-	for _, audioType := range filters.Audios {
-		supportedAudioTypes[string(audioType)] = struct{}{}
+	if filters.Audios != nil {
+		supportedAudioTypes := map[string]struct{}{}
+		for _, audioType := range filters.Audios {
+			supportedAudioTypes[string(audioType)] = struct{}{}
+		}
+
+		filterContentType(audioContentType, supportedAudioTypes, false, d.codecs, manifest)
 	}
 
-	filterContentType(audioContentType, supportedAudioTypes, manifest)
+	if filters.KeepAudios != nil {
+		keptAudioTypes := map[string]struct{}{}
+		for _, audioType := range filters.KeepAudios {
+			keptAudioTypes[string(audioType)] = struct{}{}
+		}
+
+		filterContentType(audioContentType, keptAudioTypes, true, d.codecs, manifest)
+	}
 }
 
 func (d *DASHFilter) filterCaptionTypes(filters *parsers.MediaFilters, manifest *mpd.MPD) {
-	supportedCaptionTypes := map[string]struct{}{}
-	for _, captionType := range filters.CaptionTypes {
-		supportedCaptionTypes[string(captionType)] = struct{}{}
+	if filters.CaptionTypes != nil {
+		supportedCaptionTypes := map[string]struct{}{}
+		for _, captionType := range filters.CaptionTypes {
+			supportedCaptionTypes[string(captionType)] = struct{}{}
+		}
+
+		filterContentType(captionContentType, supportedCaptionTypes, false, d.codecs, manifest)
+	}
+
+	if filters.KeepCaptionTypes != nil {
+		keptCaptionTypes := map[string]struct{}{}
+		for _, captionType := range filters.KeepCaptionTypes {
+			keptCaptionTypes[string(captionType)] = struct{}{}
+		}
+
+		filterContentType(captionContentType, keptCaptionTypes, true, d.codecs, manifest)
+	}
+}
+
+func (d *DASHFilter) filterAudioLanguages(filters *parsers.MediaFilters, manifest *mpd.MPD) {
+	if filters.AudioLanguages != nil {
+		filteredAudioLanguages := map[string]struct{}{}
+		for _, audioLanguage := range filters.AudioLanguages {
+			filteredAudioLanguages[strings.ToLower(string(audioLanguage))] = struct{}{}
+		}
+
+		filterLanguage(audioContentType, filteredAudioLanguages, false, manifest)
+	}
+
+	if filters.KeepAudioLanguages != nil {
+		keptAudioLanguages := map[string]struct{}{}
+		for _, audioLanguage := range filters.KeepAudioLanguages {
+			keptAudioLanguages[strings.ToLower(string(audioLanguage))] = struct{}{}
+		}
+
+		filterLanguage(audioContentType, keptAudioLanguages, true, manifest)
+	}
+}
+
+func (d *DASHFilter) filterAudioDescription(filters *parsers.MediaFilters, manifest *mpd.MPD) {
+	for _, period := range manifest.Periods {
+		var filteredAdaptationSets []*mpd.AdaptationSet
+		for _, as := range period.AdaptationSets {
+			if as.ContentType != nil && *as.ContentType == string(audioContentType) && isAudioDescription(as) {
+				continue
+			}
+
+			filteredAdaptationSets = append(filteredAdaptationSets, as)
+		}
+
+		for i, as := range filteredAdaptationSets {
+			as.ID = strptr(strconv.Itoa(i))
+		}
+		period.AdaptationSets = filteredAdaptationSets
+	}
+}
+
+// Returns true if the adaptation set is signaled as audio description, either with an
+// audio purpose accessibility descriptor or a description role
+func isAudioDescription(as *mpd.AdaptationSet) bool {
+	for _, access := range as.AccessibilityElems {
+		if access != nil && access.SchemeIdUri != nil && *access.SchemeIdUri == audioPurposeSchemeIDURI {
+			return true
+		}
+	}
+
+	for _, role := range as.Roles {
+		if role != nil && role.Value != nil && *role.Value == descriptionRoleValue {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *DASHFilter) filterCaptionLanguages(filters *parsers.MediaFilters, manifest *mpd.MPD) {
+	if filters.CaptionLanguages != nil {
+		filteredCaptionLanguages := map[string]struct{}{}
+		for _, captionLanguage := range filters.CaptionLanguages {
+			filteredCaptionLanguages[strings.ToLower(string(captionLanguage))] = struct{}{}
+		}
+
+		filterLanguage(captionContentType, filteredCaptionLanguages, false, manifest)
+	}
+
+	if filters.KeepCaptionLanguages != nil {
+		keptCaptionLanguages := map[string]struct{}{}
+		for _, captionLanguage := range filters.KeepCaptionLanguages {
+			keptCaptionLanguages[strings.ToLower(string(captionLanguage))] = struct{}{}
+		}
+
+		filterLanguage(captionContentType, keptCaptionLanguages, true, manifest)
 	}
+}
 
-	filterContentType(captionContentType, supportedCaptionTypes, manifest)
+// filterLanguage removes the adaptation sets of the given content type whose language is
+// listed in languages or, when keep is set, is not listed in languages
+func filterLanguage(filter ContentType, languages map[string]struct{}, keep bool, manifest *mpd.MPD) {
+	for _, period := range manifest.Periods {
+		var filteredAdaptationSets []*mpd.AdaptationSet
+		for _, as := range period.AdaptationSets {
+			if as.ContentType != nil && *as.ContentType == string(filter) && as.Lang != nil {
+				if _, listed := languages[strings.ToLower(*as.Lang)]; listed != keep {
+					continue
+				}
+			}
+
+			filteredAdaptationSets = append(filteredAdaptationSets, as)
+		}
+
+		for i, as := range filteredAdaptationSets {
+			as.ID = strptr(strconv.Itoa(i))
+		}
+		period.AdaptationSets = filteredAdaptationSets
+	}
 }
 
-func filterContentType(filter ContentType, supportedContentTypes map[string]struct{}, manifest *mpd.MPD) {
+// filterContentType removes the representations of the given content type whose codec
+// matches the supported content types or, when keep is set, matches none of them
+func filterContentType(filter ContentType, supportedContentTypes map[string]struct{}, keep bool, codecs *CodecRegistry, manifest *mpd.MPD) {
 	for _, period := range manifest.Periods {
 		var filteredAdaptationSets []*mpd.AdaptationSet
 		for _, as := range period.AdaptationSets {
@@ -135,7 +537,7 @@ func filterContentType(filter ContentType, supportedContentTypes map[string]stru
 						continue
 					}
 
-					if matchCodec(*r.Codecs, filter, supportedContentTypes) {
+					if matchCodec(*r.Codecs, supportedContentTypes, codecs) != keep {
 						continue
 					}
 
@@ -174,6 +576,10 @@ func (d *DASHFilter) filterAdaptationSetType(filters *parsers.MediaFilters, mani
 				}
 			}
 
+			if filters.DefinesIframeFilter() && d.trickModeReference(as) != nil {
+				continue
+			}
+
 			as.ID = strptr(strconv.Itoa(asIndex))
 			asIndex++
 
@@ -194,16 +600,77 @@ func (d *DASHFilter) filterAdaptationSetType(filters *parsers.MediaFilters, mani
 	manifest.Periods = filteredPeriods
 }
 
-func matchCodec(codec string, ct ContentType, supportedCodecs map[string]struct{}) bool {
-	//the key in supportedCodecs for captionContentType is equivalent to codec
-	//advertised in manifest. we can avoid iterating through each key
-	if ct == captionContentType {
-		_, found := supportedCodecs[codec]
-		return found
+// Returns the trick mode descriptor pointing at the main adaptation set, or nil if the
+// adaptation set is not a trick mode one
+func (d *DASHFilter) trickModeReference(as *mpd.AdaptationSet) *mpd.DescriptorType {
+	return d.descriptors.property(as, "EssentialProperty", trickModeSchemeIDURI)
+}
+
+// adaptationSetIDs maps the origin IDs of each period to their adaptation sets, before
+// the filters recalculate them
+func adaptationSetIDs(manifest *mpd.MPD) map[*mpd.Period]map[string]*mpd.AdaptationSet {
+	ids := map[*mpd.Period]map[string]*mpd.AdaptationSet{}
+	for _, period := range manifest.Periods {
+		ids[period] = map[string]*mpd.AdaptationSet{}
+		for _, as := range period.AdaptationSets {
+			if as.ID != nil {
+				ids[period][*as.ID] = as
+			}
+		}
+	}
+
+	return ids
+}
+
+// filterTrickModeReferences points the trick mode adaptation sets at the recalculated
+// ID of their main adaptation set, and removes the ones whose main adaptation set was
+// filtered out
+func (d *DASHFilter) filterTrickModeReferences(originalIDs map[*mpd.Period]map[string]*mpd.AdaptationSet, manifest *mpd.MPD) {
+	for _, period := range manifest.Periods {
+		remaining := map[*mpd.AdaptationSet]struct{}{}
+		for _, as := range period.AdaptationSets {
+			remaining[as] = struct{}{}
+		}
+
+		var filteredAdaptationSets []*mpd.AdaptationSet
+		for _, as := range period.AdaptationSets {
+			if reference := d.trickModeReference(as); reference != nil && reference.Value != nil {
+				if main, found := originalIDs[period][*reference.Value]; found {
+					if _, kept := remaining[main]; !kept {
+						continue
+					}
+				}
+			}
+
+			filteredAdaptationSets = append(filteredAdaptationSets, as)
+		}
+
+		if len(filteredAdaptationSets) != len(period.AdaptationSets) {
+			for i, as := range filteredAdaptationSets {
+				as.ID = strptr(strconv.Itoa(i))
+			}
+		}
+		period.AdaptationSets = filteredAdaptationSets
+
+		for _, as := range period.AdaptationSets {
+			if reference := d.trickModeReference(as); reference != nil && reference.Value != nil {
+				if main, found := originalIDs[period][*reference.Value]; found {
+					reference.Value = main.ID
+				}
+			}
+		}
+	}
+}
+
+func matchCodec(codec string, supportedCodecs map[string]struct{}, codecs *CodecRegistry) bool {
+	//the key in supportedCodecs is often equivalent to the codec advertised
+	//in manifest. we can avoid iterating through each key
+	if _, found := supportedCodecs[codec]; found {
+		return true
 	}
 
 	for key := range supportedCodecs {
-		if ValidCodecs(codec, CodecFilterID(key)) {
+		if codecs.Matches(codec, key) {
 			return true
 		}
 	}
@@ -212,35 +679,655 @@ func matchCodec(codec string, ct ContentType, supportedCodecs map[string]struct{
 }
 
 func (d *DASHFilter) filterBandwidth(filters *parsers.MediaFilters, manifest *mpd.MPD) {
-	for _, period := range manifest.Periods {
-		var filteredAdaptationSets []*mpd.AdaptationSet
+	filterRepresentations(manifest, func(as *mpd.AdaptationSet, r *mpd.Representation) bool {
+		// representations without a bandwidth can't be compared, so they are kept
+		if r.Bandwidth == nil {
+			return false
+		}
+
+		// the range given without a track type applies to video only, as for HLS variants
+		bandwidth := int(*r.Bandwidth)
+		switch representationContentType(as, r) {
+		case videoContentType:
+			if filters.DefinesBitrateFilter() && (bandwidth > filters.MaxBitrate || bandwidth < filters.MinBitrate) {
+				return true
+			}
+
+			return filters.VideoBitrate != nil && !filters.VideoBitrate.Includes(bandwidth)
+		case audioContentType:
+			return filters.AudioBitrate != nil && !filters.AudioBitrate.Includes(bandwidth)
+		}
+
+		return false
+	})
+}
 
+// filterLadderSize keeps, within each adaptation set, the representations picked by the
+// ladder size. Representations without a bandwidth are always kept
+func (d *DASHFilter) filterLadderSize(filters *parsers.MediaFilters, manifest *mpd.MPD) {
+	for _, period := range manifest.Periods {
 		for _, as := range period.AdaptationSets {
-			var filteredRepresentations []*mpd.Representation
+			var ladder []*mpd.Representation
+			var bandwidths []int64
+			for _, r := range as.Representations {
+				if r.Bandwidth != nil {
+					ladder = append(ladder, r)
+					bandwidths = append(bandwidths, *r.Bandwidth)
+				}
+			}
 
+			kept := map[*mpd.Representation]struct{}{}
+			for i := range selectLadder(bandwidths, *filters.LadderSize) {
+				kept[ladder[i]] = struct{}{}
+			}
+
+			var filteredReps []*mpd.Representation
 			for _, r := range as.Representations {
-				if r.Bandwidth == nil {
-					continue
+				if _, found := kept[r]; found || r.Bandwidth == nil {
+					filteredReps = append(filteredReps, r)
 				}
-				if *r.Bandwidth <= int64(filters.MaxBitrate) && *r.Bandwidth >= int64(filters.MinBitrate) {
-					filteredRepresentations = append(filteredRepresentations, r)
+			}
+			as.Representations = filteredReps
+		}
+	}
+}
+
+// Returns the content type of a representation, read from the contentType or mimeType
+// of its adaptation set, or from its own mimeType
+func representationContentType(as *mpd.AdaptationSet, r *mpd.Representation) ContentType {
+	if as.ContentType != nil && *as.ContentType != "" {
+		return ContentType(*as.ContentType)
+	}
+
+	for _, mimeType := range []*string{r.MimeType, as.MimeType} {
+		if mimeType != nil && *mimeType != "" {
+			contentType := ContentType(strings.SplitN(*mimeType, "/", 2)[0])
+			if contentType == "application" {
+				return captionContentType
+			}
+			return contentType
+		}
+	}
+
+	return ""
+}
+
+func (d *DASHFilter) filterResolution(filters *parsers.MediaFilters, manifest *mpd.MPD) {
+	filterRepresentations(manifest, func(as *mpd.AdaptationSet, r *mpd.Representation) bool {
+		width, height := representationResolution(as, r)
+		if width == 0 && height == 0 {
+			return false
+		}
+
+		return !filters.Resolution.Includes(width, height)
+	})
+}
+
+func (d *DASHFilter) filterFrameRate(filters *parsers.MediaFilters, manifest *mpd.MPD) {
+	filterRepresentations(manifest, func(as *mpd.AdaptationSet, r *mpd.Representation) bool {
+		frameRate := r.FrameRate
+		if frameRate == nil {
+			frameRate = as.FrameRate
+		}
+
+		if frameRate == nil {
+			return false
+		}
+
+		fps, err := parseFrameRate(*frameRate)
+		if err != nil {
+			return false
+		}
+
+		return !filters.FrameRate.Includes(fps)
+	})
+}
+
+func (d *DASHFilter) filterVideoRanges(filters *parsers.MediaFilters, manifest *mpd.MPD) {
+	filteredVideoRanges := map[parsers.VideoRange]struct{}{}
+	for _, videoRange := range filters.VideoRanges {
+		filteredVideoRanges[videoRange] = struct{}{}
+	}
+
+	filterRepresentations(manifest, func(as *mpd.AdaptationSet, r *mpd.Representation) bool {
+		if as.ContentType == nil || *as.ContentType != string(videoContentType) {
+			return false
+		}
+
+		_, filtered := filteredVideoRanges[d.representationVideoRange(as, r)]
+		return filtered
+	})
+}
+
+// Returns the video range signaled by the transfer characteristics descriptors of a
+// representation, falling back to the ones set on its adaptation set
+func (d *DASHFilter) representationVideoRange(as *mpd.AdaptationSet, r *mpd.Representation) parsers.VideoRange {
+	for _, parent := range []interface{}{r, as} {
+		properties := append(d.descriptors.elements(parent, "EssentialProperty"),
+			d.descriptors.elements(parent, "SupplementalProperty")...)
+		for _, descriptor := range properties {
+			if descriptor.SchemeIDURI == nil || *descriptor.SchemeIDURI != transferCharacteristicsSchemeIDURI ||
+				descriptor.Value == nil {
+				continue
+			}
+
+			if videoRange, found := transferCharacteristicsVideoRanges[*descriptor.Value]; found {
+				return videoRange
+			}
+			return sdrVideoRange
+		}
+	}
+
+	return sdrVideoRange
+}
+
+func (d *DASHFilter) filterAudioChannels(filters *parsers.MediaFilters, manifest *mpd.MPD) {
+	filterRepresentations(manifest, func(as *mpd.AdaptationSet, r *mpd.Representation) bool {
+		if as.ContentType == nil || *as.ContentType != string(audioContentType) {
+			return false
+		}
+
+		channels := d.representationChannels(as, r)
+		return channels != 0 && !filters.AudioChannels.Includes(channels)
+	})
+}
+
+// Returns the channel count signaled by the AudioChannelConfiguration of a representation,
+// falling back to the one set on its adaptation set, or 0 if none can be read
+func (d *DASHFilter) representationChannels(as *mpd.AdaptationSet, r *mpd.Representation) int {
+	for _, parent := range []interface{}{r, as} {
+		for _, configuration := range d.descriptors.elements(parent, "AudioChannelConfiguration") {
+			if configuration.SchemeIDURI == nil || configuration.Value == nil {
+				continue
+			}
+
+			if channels := channelCount(*configuration.SchemeIDURI, *configuration.Value); channels != 0 {
+				return channels
+			}
+		}
+	}
+
+	return 0
+}
+
+// channelCount reads the number of channels of an AudioChannelConfiguration value
+func channelCount(scheme, value string) int {
+	switch scheme {
+	case channelCountSchemeIDURI:
+		channels, _ := strconv.Atoi(value)
+		return channels
+	case cicpChannelSchemeIDURI:
+		return cicpChannelCounts[value]
+	case dolbyChannelSchemeIDURI, legacyDolbyChannelSchemeIDURI:
+		mask, err := strconv.ParseUint(value, 16, 16)
+		if err != nil {
+			return 0
+		}
+
+		channels := bits.OnesCount16(uint16(mask))
+		for _, pair := range dolbyChannelPairs {
+			if mask&(1<<pair) != 0 {
+				channels++
+			}
+		}
+		return channels
+	}
+
+	return 0
+}
+
+func (d *DASHFilter) filterVideoLevels(filters *parsers.MediaFilters, manifest *mpd.MPD) {
+	filterRepresentations(manifest, func(as *mpd.AdaptationSet, r *mpd.Representation) bool {
+		codecs := r.Codecs
+		if codecs == nil {
+			codecs = as.Codecs
+		}
+
+		return codecs != nil && exceedsVideoLevel(*codecs, filters.VideoLevels)
+	})
+}
+
+// filterRepresentations removes the representations for which remove returns true, along
+// with the adaptation sets left without any representation
+func filterRepresentations(manifest *mpd.MPD, remove func(*mpd.AdaptationSet, *mpd.Representation) bool) {
+	for _, period := range manifest.Periods {
+		var filteredAdaptationSets []*mpd.AdaptationSet
+		for _, as := range period.AdaptationSets {
+			var filteredReps []*mpd.Representation
+			for _, r := range as.Representations {
+				if remove(as, r) {
+					continue
 				}
+
+				filteredReps = append(filteredReps, r)
 			}
-			as.Representations = filteredRepresentations
+			as.Representations = filteredReps
+
 			if len(as.Representations) != 0 {
 				filteredAdaptationSets = append(filteredAdaptationSets, as)
 			}
 		}
 
+		for i, as := range filteredAdaptationSets {
+			as.ID = strptr(strconv.Itoa(i))
+		}
 		period.AdaptationSets = filteredAdaptationSets
+	}
+}
+
+// Returns the width and height of a representation, falling back to the ones set on
+// its adaptation set
+func representationResolution(as *mpd.AdaptationSet, r *mpd.Representation) (int, int) {
+	var width, height int
+	if r.Width != nil {
+		width = int(*r.Width)
+	} else if as.Width != nil {
+		width, _ = strconv.Atoi(*as.Width)
+	}
+
+	if r.Height != nil {
+		height = int(*r.Height)
+	} else if as.Height != nil {
+		height, _ = strconv.Atoi(*as.Height)
+	}
+
+	return width, height
+}
 
-		// Recalculate AdaptationSet id numbers
-		for index, as := range period.AdaptationSets {
-			as.ID = strptr(strconv.Itoa(index))
+// parseFrameRate reads a frame rate formatted either as a number or as a fraction,
+// such as 30000/1001
+func parseFrameRate(frameRate string) (float64, error) {
+	parts := strings.SplitN(frameRate, "/", 2)
+	fps, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing frame rate %q: %w", frameRate, err)
+	}
+
+	if len(parts) == 2 {
+		denominator, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || denominator == 0 {
+			return 0, fmt.Errorf("parsing frame rate %q: invalid denominator", frameRate)
 		}
+		fps /= denominator
 	}
+
+	return fps, nil
 }
 
 func strptr(s string) *string {
 	return &s
 }
+
+// trimSpan is a presentation time range, in seconds
+type trimSpan struct {
+	start, end float64
+}
+
+// now returns the current time, which the live edge of dynamic manifests is read from
+var now = time.Now
+
+// trimManifest turns the manifest into a static one covering only the segments of the
+// trim. Segment times are read from the segment templates of the periods, adaptation
+// sets and representations. They are matched against the trim as wall-clock times from
+// the availability start time, or as offsets from the start of the presentation. Trims
+// of dynamic manifests ending after the live edge are still being recorded, so those
+// manifests stay dynamic and end with the trim
+func trimManifest(trim *parsers.Trim, manifest *mpd.MPD) error {
+	var availabilityStart float64
+	if manifest.AvailabilityStartTime != nil {
+		availabilityStartTime, err := time.Parse(time.RFC3339, *manifest.AvailabilityStartTime)
+		if err != nil {
+			return fmt.Errorf("parsing availability start time: %w", err)
+		}
+		availabilityStart = float64(availabilityStartTime.UnixNano()) / float64(time.Second)
+	} else if !trim.Offset {
+		return fmt.Errorf("Availability Start Time not set on manifest")
+	}
+
+	// origin is the Unix time of the start of the presentation
+	var origin float64
+	if !trim.Offset {
+		origin = availabilityStart
+	}
+
+	spans, err := periodSpans(manifest)
+	if err != nil {
+		return err
+	}
+
+	// segments of dynamic manifests are only available once they end before the live edge
+	liveEdge := math.Inf(1)
+	if manifest.Type != nil && *manifest.Type == "dynamic" && manifest.AvailabilityStartTime != nil {
+		liveEdge = float64(now().UnixNano())/float64(time.Second) - availabilityStart
+	}
+	trimEnd := float64(trim.End) - origin
+	live := trimEnd > liveEdge
+
+	// without a live edge, the segments of the templates are only bounded by the end of the
+	// presentation, so a trim ending far away would go through them endlessly
+	if last := len(spans) - 1; last >= 0 && math.IsInf(liveEdge, 1) && math.IsInf(spans[last].end, 1) {
+		return fmt.Errorf("bounding period %q: media presentation duration and period duration not set",
+			manifest.Periods[last].ID)
+	}
+
+	var trimmedPeriods []*mpd.Period
+	var trimmedSpans []trimSpan
+	for i, period := range manifest.Periods {
+		kept, found, err := trimPeriod(trim, origin, liveEdge, period, spans[i])
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			continue
+		}
+
+		trimmedPeriods = append(trimmedPeriods, period)
+		trimmedSpans = append(trimmedSpans, kept)
+	}
+	manifest.Periods = trimmedPeriods
+
+	if live {
+		// periods keep their place on the timeline of the availability start time, the
+		// last one growing with the live edge until the end of the trim
+		for i, period := range trimmedPeriods {
+			start := mpd.Duration(secondsDuration(trimmedSpans[i].start))
+			period.Start = &start
+			period.Duration = 0
+			if i+1 < len(trimmedPeriods) {
+				period.Duration = mpd.Duration(secondsDuration(trimmedSpans[i].end - trimmedSpans[i].start))
+			}
+		}
+
+		presentationDuration := mpd.Duration(secondsDuration(trimEnd))
+		manifest.MediaPresentationDuration = strptr(presentationDuration.String())
+		manifest.TimeShiftBufferDepth = nil
+
+		return nil
+	}
+
+	// the trimmed presentation starts with the first segment kept
+	var duration float64
+	for i, period := range trimmedPeriods {
+		start := mpd.Duration(secondsDuration(trimmedSpans[i].start - trimmedSpans[0].start))
+		period.Start = &start
+		period.Duration = mpd.Duration(secondsDuration(trimmedSpans[i].end - trimmedSpans[i].start))
+		duration = trimmedSpans[i].end - trimmedSpans[0].start
+	}
+
+	manifest.Type = strptr("static")
+	presentationDuration := mpd.Duration(secondsDuration(duration))
+	manifest.MediaPresentationDuration = strptr(presentationDuration.String())
+	manifest.AvailabilityStartTime = nil
+	manifest.MinimumUpdatePeriod = nil
+	manifest.TimeShiftBufferDepth = nil
+	manifest.SuggestedPresentationDelay = nil
+
+	return nil
+}
+
+// periodSpans returns the presentation time range of each period. Periods without a
+// start follow the previous one, and the end of the last period is the end of the
+// presentation, which is unbounded when unknown as in live manifests
+func periodSpans(manifest *mpd.MPD) ([]trimSpan, error) {
+	spans := make([]trimSpan, len(manifest.Periods))
+	for i, period := range manifest.Periods {
+		switch {
+		case period.Start != nil:
+			spans[i].start = time.Duration(*period.Start).Seconds()
+		case i == 0:
+			spans[i].start = 0
+		case manifest.Periods[i-1].Duration != 0:
+			spans[i].start = spans[i-1].start + time.Duration(manifest.Periods[i-1].Duration).Seconds()
+		default:
+			return nil, fmt.Errorf("placing period %q: start not set and previous period without duration", period.ID)
+		}
+	}
+
+	for i, period := range manifest.Periods {
+		switch {
+		case i+1 < len(manifest.Periods):
+			spans[i].end = spans[i+1].start
+		case period.Duration != 0:
+			spans[i].end = spans[i].start + time.Duration(period.Duration).Seconds()
+		case manifest.MediaPresentationDuration != nil:
+			duration, err := mpd.ParseDuration(*manifest.MediaPresentationDuration)
+			if err != nil {
+				return nil, fmt.Errorf("parsing media presentation duration: %w", err)
+			}
+			spans[i].end = duration.Seconds()
+		default:
+			spans[i].end = math.Inf(1)
+		}
+	}
+
+	return spans, nil
+}
+
+// trimPeriod keeps the segments of the period templates matching the trim and returns
+// the range they cover. The presentation time offsets and the start numbers are moved so
+// that the period starts with its first segment kept. Periods without segment templates
+// are kept whole when they overlap the trim
+func trimPeriod(trim *parsers.Trim, origin, liveEdge float64, period *mpd.Period, span trimSpan) (trimSpan, bool, error) {
+	var templates []*mpd.SegmentTemplate
+	seen := map[*mpd.SegmentTemplate]struct{}{}
+	addTemplate := func(st *mpd.SegmentTemplate) {
+		if _, found := seen[st]; st != nil && !found {
+			seen[st] = struct{}{}
+			templates = append(templates, st)
+		}
+	}
+
+	addTemplate(period.SegmentTemplate)
+	for _, as := range period.AdaptationSets {
+		addTemplate(as.SegmentTemplate)
+		for _, r := range as.Representations {
+			addTemplate(r.SegmentTemplate)
+		}
+	}
+
+	if len(templates) == 0 {
+		overlap := &parsers.Trim{Start: trim.Start, End: trim.End, Boundary: parsers.TrimOverlap}
+		return span, span.start < liveEdge && inTrim(overlap, origin+span.start, origin+span.end), nil
+	}
+
+	kept := trimSpan{start: math.Inf(1), end: math.Inf(-1)}
+	for _, st := range templates {
+		templateSpan, found, err := trimSegmentTemplate(trim, origin, liveEdge, st, span)
+		if err != nil {
+			return trimSpan{}, false, err
+		}
+
+		if found {
+			kept.start = math.Min(kept.start, templateSpan.start)
+			kept.end = math.Max(kept.end, templateSpan.end)
+		}
+	}
+
+	if math.IsInf(kept.start, 1) {
+		return trimSpan{}, false, nil
+	}
+
+	for _, st := range templates {
+		timescale := float64(templateTimescale(st))
+		offset := uint64(math.Round((kept.start-span.start)*timescale)) + templatePresentationTimeOffset(st)
+		st.PresentationTimeOffset = &offset
+
+		// segments of templates without timeline are numbered from the start of the period
+		if st.SegmentTimeline == nil && st.Duration != nil && *st.Duration > 0 {
+			dropped := int64(math.Round((kept.start - span.start) * timescale / float64(*st.Duration)))
+			moveStartNumber(st, dropped)
+		}
+	}
+
+	return kept, true, nil
+}
+
+// trimSegmentTemplate keeps the segments of the template matching the trim, rewriting
+// its segment timeline and start number, and returns the range they cover. Templates
+// without timeline only have their range computed, as the presentation time offset,
+// the start number and the period duration are enough to bound their segments
+func trimSegmentTemplate(trim *parsers.Trim, origin, liveEdge float64, st *mpd.SegmentTemplate, span trimSpan) (trimSpan, bool, error) {
+	timescale := float64(templateTimescale(st))
+	offset := float64(templatePresentationTimeOffset(st))
+	trimEnd := float64(trim.End) - origin
+
+	// presentationTime returns the presentation time of a time of the template
+	presentationTime := func(t float64) float64 {
+		return span.start + (t-offset)/timescale
+	}
+
+	// keep returns true if the segment is available, part of the period and matches the trim
+	keep := func(start, end float64) bool {
+		return end <= liveEdge && end > span.start && start < span.end && inTrim(trim, origin+start, origin+end)
+	}
+
+	kept := trimSpan{start: math.Inf(1), end: math.Inf(-1)}
+	addSegment := func(start, end float64) {
+		kept.start = math.Min(kept.start, math.Max(start, span.start))
+		kept.end = math.Max(kept.end, math.Min(end, span.end))
+	}
+
+	if st.SegmentTimeline == nil {
+		if st.Duration == nil || *st.Duration <= 0 {
+			return trimSpan{}, false, nil
+		}
+
+		// segments are numbered from the start of the period, the first one starting at
+		// the presentation time offset
+		duration := float64(*st.Duration)
+		segmentTime := func(k float64) float64 {
+			return presentationTime(k*duration + offset)
+		}
+
+		first := math.Max(0, math.Floor((float64(trim.Start)-origin-span.start)*timescale/duration)-1)
+		for k := first; segmentTime(k) <= trimEnd && segmentTime(k) < span.end && segmentTime(k+1) <= liveEdge; k++ {
+			if start, end := segmentTime(k), segmentTime(k+1); keep(start, end) {
+				addSegment(start, end)
+			}
+		}
+
+		return kept, !math.IsInf(kept.start, 1), nil
+	}
+
+	timeline := st.SegmentTimeline.Segments
+	for _, s := range timeline {
+		if s.Duration == 0 {
+			return trimSpan{}, false, fmt.Errorf("segment timeline entry with zero duration")
+		}
+	}
+
+	// dropped counts the segments of the timeline before the first one kept, which the
+	// start number is moved by
+	var segments []*mpd.SegmentTimelineSegment
+	var t uint64
+	var dropped int64
+	for i, s := range timeline {
+		if s.StartTime != nil {
+			t = *s.StartTime
+		}
+
+		// a negative repeat count repeats the segment up to the next one, or up to the
+		// end of the period or the live edge
+		repeat := 0
+		if s.RepeatCount != nil {
+			repeat = *s.RepeatCount
+		}
+
+		for n := 0; repeat < 0 || n <= repeat; n++ {
+			start, end := presentationTime(float64(t)), presentationTime(float64(t+s.Duration))
+			if repeat < 0 && (start >= span.end || start > trimEnd || end > liveEdge ||
+				(i+1 < len(timeline) && timeline[i+1].StartTime != nil && t >= *timeline[i+1].StartTime)) {
+				break
+			}
+
+			if keep(start, end) {
+				addSegment(start, end)
+				segments = appendTimelineSegment(segments, t, s.Duration)
+			} else if len(segments) == 0 {
+				dropped++
+			}
+			t += s.Duration
+		}
+	}
+	st.SegmentTimeline.Segments = segments
+
+	if len(segments) == 0 {
+		return kept, false, nil
+	}
+
+	moveStartNumber(st, dropped)
+
+	return kept, true, nil
+}
+
+// appendTimelineSegment adds a segment to a timeline, repeating the last entry when the
+// segment follows it with the same duration
+func appendTimelineSegment(segments []*mpd.SegmentTimelineSegment, t, duration uint64) []*mpd.SegmentTimelineSegment {
+	if len(segments) > 0 {
+		last := segments[len(segments)-1]
+		repeat := 0
+		if last.RepeatCount != nil {
+			repeat = *last.RepeatCount
+		}
+
+		if last.Duration == duration && *last.StartTime+uint64(repeat+1)*duration == t {
+			repeat++
+			last.RepeatCount = &repeat
+			return segments
+		}
+	}
+
+	start := t
+	return append(segments, &mpd.SegmentTimelineSegment{StartTime: &start, Duration: duration})
+}
+
+// Returns the timescale of the segment template, 1 when not set
+func templateTimescale(st *mpd.SegmentTemplate) int64 {
+	if st.Timescale == nil || *st.Timescale <= 0 {
+		return 1
+	}
+
+	return *st.Timescale
+}
+
+// moveStartNumber moves the start number of templates addressing their segments by
+// number past the segments dropped, the start number being 1 when not set
+func moveStartNumber(st *mpd.SegmentTemplate, dropped int64) {
+	if dropped == 0 || !templateUsesNumber(st) {
+		return
+	}
+
+	number := int64(1)
+	if st.StartNumber != nil {
+		number = *st.StartNumber
+	}
+
+	number += dropped
+	st.StartNumber = &number
+}
+
+// Returns true if the media or initialization of the segment template use $Number$
+func templateUsesNumber(st *mpd.SegmentTemplate) bool {
+	for _, template := range []*string{st.Media, st.Initialization} {
+		if template != nil && strings.Contains(*template, "$Number") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the presentation time offset of the segment template, 0 when not set
+func templatePresentationTimeOffset(st *mpd.SegmentTemplate) uint64 {
+	if st.PresentationTimeOffset == nil {
+		return 0
+	}
+
+	return *st.PresentationTimeOffset
+}
+
+// secondsDuration converts seconds to a duration rounded to the millisecond
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(math.Round(seconds*1000)) * time.Millisecond
+}
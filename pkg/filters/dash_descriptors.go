@@ -0,0 +1,220 @@
+package filters
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/zencoder/go-dash/mpd"
+)
+
+// descriptorElements are the descriptor elements go-dash can't read as repeated elements:
+// it rejects them in adaptation sets and keeps at most one of them in representations.
+// They are set aside before the manifest is read and written back once it is filtered
+var descriptorElements = map[string]struct{}{
+	"AudioChannelConfiguration": {},
+	"EssentialProperty":         {},
+	"SupplementalProperty":      {},
+}
+
+// descriptor is a descriptor element set aside from an adaptation set or a representation
+type descriptor struct {
+	XMLName xml.Name
+	mpd.DescriptorType
+}
+
+// descriptors holds the descriptor elements of each adaptation set and representation
+type descriptors map[interface{}][]*descriptor
+
+// readManifest reads an MPD along with the descriptor elements of its adaptation sets
+// and representations
+func readManifest(content string) (*mpd.MPD, descriptors, error) {
+	stripped, adaptationSets, representations, err := cutDescriptors(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifest, err := mpd.ReadFromString(stripped)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := descriptors{}
+	var asIndex, rIndex int
+	for _, period := range manifest.Periods {
+		for _, as := range period.AdaptationSets {
+			if asIndex < len(adaptationSets) {
+				found[as] = adaptationSets[asIndex]
+			}
+			asIndex++
+
+			for _, r := range as.Representations {
+				if rIndex < len(representations) {
+					found[r] = representations[rIndex]
+				}
+				rIndex++
+			}
+		}
+	}
+
+	return manifest, found, nil
+}
+
+// cutDescriptors removes the descriptor elements of the adaptation sets and representations
+// from the manifest, returning them in the order their parents appear in
+func cutDescriptors(content string) (string, [][]*descriptor, [][]*descriptor, error) {
+	var adaptationSets, representations [][]*descriptor
+	var stripped strings.Builder
+	var parents []string
+	var kept int64
+
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			var parent string
+			if len(parents) > 0 {
+				parent = parents[len(parents)-1]
+			}
+
+			_, isDescriptor := descriptorElements[t.Name.Local]
+			if isDescriptor && (parent == "AdaptationSet" || parent == "Representation") {
+				d := &descriptor{}
+				if err := decoder.DecodeElement(d, &t); err != nil {
+					return "", nil, nil, err
+				}
+				d.XMLName = xml.Name{Local: t.Name.Local}
+
+				if parent == "AdaptationSet" {
+					adaptationSets[len(adaptationSets)-1] = append(adaptationSets[len(adaptationSets)-1], d)
+				} else {
+					representations[len(representations)-1] = append(representations[len(representations)-1], d)
+				}
+
+				stripped.WriteString(content[kept:offset])
+				kept = decoder.InputOffset()
+				continue
+			}
+
+			switch t.Name.Local {
+			case "AdaptationSet":
+				adaptationSets = append(adaptationSets, nil)
+			case "Representation":
+				representations = append(representations, nil)
+			}
+			parents = append(parents, t.Name.Local)
+		case xml.EndElement:
+			if len(parents) > 0 {
+				parents = parents[:len(parents)-1]
+			}
+		}
+	}
+	stripped.WriteString(content[kept:])
+
+	return stripped.String(), adaptationSets, representations, nil
+}
+
+// writeManifest writes the MPD with the descriptor elements of its adaptation sets and
+// representations placed first in them
+func writeManifest(manifest *mpd.MPD, found descriptors) (string, error) {
+	content, err := manifest.WriteToString()
+	if err != nil {
+		return "", err
+	}
+
+	var adaptationSets, representations [][]*descriptor
+	for _, period := range manifest.Periods {
+		for _, as := range period.AdaptationSets {
+			adaptationSets = append(adaptationSets, found[as])
+			for _, r := range as.Representations {
+				representations = append(representations, found[r])
+			}
+		}
+	}
+
+	var written strings.Builder
+	var kept int64
+	var asIndex, rIndex int
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var elements []*descriptor
+		switch start.Name.Local {
+		case "AdaptationSet":
+			if asIndex < len(adaptationSets) {
+				elements = adaptationSets[asIndex]
+			}
+			asIndex++
+		case "Representation":
+			if rIndex < len(representations) {
+				elements = representations[rIndex]
+			}
+			rIndex++
+		}
+
+		if len(elements) == 0 {
+			continue
+		}
+
+		// the elements are indented one level below their parent, which is written on
+		// a line of its own
+		end := decoder.InputOffset()
+		indent := content[strings.LastIndex(content[:offset], "\n")+1 : offset]
+		written.WriteString(content[kept:end])
+		for _, element := range elements {
+			encoded, err := xml.Marshal(element)
+			if err != nil {
+				return "", err
+			}
+			written.WriteString("\n" + indent + "  ")
+			written.Write(encoded)
+		}
+		if strings.HasPrefix(content[end:], "</") {
+			written.WriteString("\n" + indent)
+		}
+		kept = end
+	}
+	written.WriteString(content[kept:])
+
+	return written.String(), nil
+}
+
+// property returns the first descriptor element of an adaptation set or representation
+// with the given name and scheme, or nil if there is none
+func (ds descriptors) property(parent interface{}, element, schemeIDURI string) *mpd.DescriptorType {
+	for _, d := range ds[parent] {
+		if d.XMLName.Local == element && d.SchemeIDURI != nil && *d.SchemeIDURI == schemeIDURI {
+			return &d.DescriptorType
+		}
+	}
+
+	return nil
+}
+
+// elements returns the descriptor elements of an adaptation set or representation with
+// the given name
+func (ds descriptors) elements(parent interface{}, element string) []*mpd.DescriptorType {
+	var elements []*mpd.DescriptorType
+	for _, d := range ds[parent] {
+		if d.XMLName.Local == element {
+			elements = append(elements, &d.DescriptorType)
+		}
+	}
+
+	return elements
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"testing"
+	"time"
 
 	"github.com/cbsinteractive/bakery/pkg/config"
 	"github.com/cbsinteractive/bakery/pkg/parsers"
@@ -682,6 +683,20 @@ func TestDASHFilter_FilterManifest_bitrate(t *testing.T) {
     </AdaptationSet>
   </Period>
 </MPD>
+`
+
+	manifestFiltering2048Representation := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="4096" codecs="avc" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
 `
 
 	manifestFiltering4096Representation := `<?xml version="1.0" encoding="UTF-8"?>
@@ -750,6 +765,16 @@ func TestDASHFilter_FilterManifest_bitrate(t *testing.T) {
 			name:                  "when hitting upper bounary (maxBitrate = math.MaxInt32), expect results to be filtered",
 			filters:               &parsers.MediaFilters{MinBitrate: 4000, MaxBitrate: math.MaxInt32},
 			manifestContent:       baseManifest,
+			expectManifestContent: manifestFiltering2048Representation,
+		},
+		{
+			name: "when audio is given the same range, expect audio below it to be filtered",
+			filters: &parsers.MediaFilters{
+				MinBitrate:   4000,
+				MaxBitrate:   math.MaxInt32,
+				AudioBitrate: &parsers.BitrateRange{Min: 4000, Max: math.MaxInt32},
+			},
+			manifestContent:       baseManifest,
 			expectManifestContent: manifestFiltering256And2048Representations,
 		},
 		{
@@ -886,3 +911,1777 @@ func TestDASHFilter_FilterRole_OverwriteValue(t *testing.T) {
 		})
 	}
 }
+
+func TestDASHFilter_FilterManifest_audioLanguages(t *testing.T) {
+	manifestWithMultiAudioLanguages := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="2048" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="mp4a.40.2" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="pt-BR" contentType="audio">
+      <Representation bandwidth="256" codecs="mp4a.40.2" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="3" lang="pt-BR" contentType="text">
+      <Representation bandwidth="256" codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithoutPortugueseAudio := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="2048" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="mp4a.40.2" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="pt-BR" contentType="text">
+      <Representation bandwidth="256" codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithoutAudio := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="2048" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="pt-BR" contentType="text">
+      <Representation bandwidth="256" codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+	}{
+		{
+			name:                  "when no audio language filter is given, the manifest is not modified",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithMultiAudioLanguages,
+			expectManifestContent: manifestWithMultiAudioLanguages,
+		},
+		{
+			name:                  "when an audio language is filtered, only the audio adaptation set in that language is removed",
+			filters:               &parsers.MediaFilters{AudioLanguages: []parsers.AudioLanguage{"pt-br"}},
+			manifestContent:       manifestWithMultiAudioLanguages,
+			expectManifestContent: manifestWithoutPortugueseAudio,
+		},
+		{
+			name:                  "when every audio language is filtered, all audio adaptation sets are removed",
+			filters:               &parsers.MediaFilters{AudioLanguages: []parsers.AudioLanguage{"en", "pt-BR"}},
+			manifestContent:       manifestWithMultiAudioLanguages,
+			expectManifestContent: manifestWithoutAudio,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_captionLanguages(t *testing.T) {
+	manifestWithMultiCaptionLanguages := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="mp4a.40.2" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="text">
+      <Representation bandwidth="256" codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="es-MX" contentType="text">
+      <Representation bandwidth="256" codecs="stpp" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithoutEnglishCaptions := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="mp4a.40.2" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="es-MX" contentType="text">
+      <Representation bandwidth="256" codecs="stpp" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+	}{
+		{
+			name:                  "when no caption language filter is given, the manifest is not modified",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithMultiCaptionLanguages,
+			expectManifestContent: manifestWithMultiCaptionLanguages,
+		},
+		{
+			name:                  "when a caption language is filtered, only the text adaptation set in that language is removed",
+			filters:               &parsers.MediaFilters{CaptionLanguages: []parsers.CaptionLanguage{"en"}},
+			manifestContent:       manifestWithMultiCaptionLanguages,
+			expectManifestContent: manifestWithoutEnglishCaptions,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_audioDescription(t *testing.T) {
+	manifestWithAudioDescription := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="audio">
+      <Role schemeIdUri="urn:mpeg:dash:role:2011" value="main"></Role>
+      <Representation bandwidth="256" codecs="ac-3" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Role schemeIdUri="urn:mpeg:dash:role:2011" value="alternate"></Role>
+      <Representation bandwidth="256" codecs="ac-3" id="1"></Representation>
+      <Accessibility schemeIdUri="urn:tva:metadata:cs:AudioPurposeCS:2007" value="1"></Accessibility>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="audio">
+      <Role schemeIdUri="urn:mpeg:dash:role:2011" value="description"></Role>
+      <Representation bandwidth="256" codecs="ac-3" id="2"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithoutAudioDescription := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="audio">
+      <Role schemeIdUri="urn:mpeg:dash:role:2011" value="main"></Role>
+      <Representation bandwidth="256" codecs="ac-3" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+	}{
+		{
+			name:                  "when no audio description filter is given, the manifest is not modified",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithAudioDescription,
+			expectManifestContent: manifestWithAudioDescription,
+		},
+		{
+			name: "when audio description filter is given, adaptation sets with an audio purpose " +
+				"accessibility element or a description role are removed",
+			filters:               &parsers.MediaFilters{Audios: []parsers.AudioType{"noAd"}},
+			manifestContent:       manifestWithAudioDescription,
+			expectManifestContent: manifestWithoutAudioDescription,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_trickMode(t *testing.T) {
+	manifestWithTrickMode := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="4000" codecs="hvc1.2.4.L93.90" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" contentType="video">
+      <Representation bandwidth="2000" codecs="avc1.64001f" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" contentType="video">
+      <EssentialProperty schemeIdUri="http://dashif.org/guidelines/trickmode" value="1"></EssentialProperty>
+      <Representation bandwidth="200" codecs="avc1.64001f" id="2"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="3" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="3"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithoutTrickMode := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0">
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="4000" codecs="hvc1.2.4.L93.90" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" contentType="video">
+      <Representation bandwidth="2000" codecs="avc1.64001f" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="3"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithTrickModeWithoutHEVC := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="2000" codecs="avc1.64001f" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" contentType="video">
+      <EssentialProperty schemeIdUri="http://dashif.org/guidelines/trickmode" value="0"></EssentialProperty>
+      <Representation bandwidth="200" codecs="avc1.64001f" id="2"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="3"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithoutVideo := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="3"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+	}{
+		{
+			name:                  "when no filter is given, the trick mode adaptation set is not modified",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithTrickMode,
+			expectManifestContent: manifestWithTrickMode,
+		},
+		{
+			name:                  "when the iframe stream type is filtered, trick mode adaptation sets are removed",
+			filters:               &parsers.MediaFilters{FilterStreamTypes: []parsers.StreamType{"iframe"}},
+			manifestContent:       manifestWithTrickMode,
+			expectManifestContent: manifestWithoutTrickMode,
+		},
+		{
+			name: "when an adaptation set before the main one is removed, the trick mode adaptation set " +
+				"points at the recalculated id",
+			filters:               &parsers.MediaFilters{Videos: []parsers.VideoType{"hvc"}},
+			manifestContent:       manifestWithTrickMode,
+			expectManifestContent: manifestWithTrickModeWithoutHEVC,
+		},
+		{
+			name:                  "when the main adaptation set is removed, its trick mode adaptation set is removed",
+			filters:               &parsers.MediaFilters{MinBitrate: 100, MaxBitrate: 1000},
+			manifestContent:       manifestWithTrickMode,
+			expectManifestContent: manifestWithoutVideo,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_resolutionAndFrameRate(t *testing.T) {
+	manifestWithLadder := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="1000" codecs="avc1.64001f" frameRate="30000/1001" height="360" id="0" width="640"></Representation>
+      <Representation bandwidth="4000" codecs="avc1.64001f" frameRate="60000/1001" height="1080" id="1" width="1920"></Representation>
+    </AdaptationSet>
+    <AdaptationSet width="3840" height="2160" frameRate="60" id="1" contentType="video">
+      <Representation bandwidth="12000" codecs="hvc1.2.4.L153.90" id="2"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="3"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestUpTo1080p := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="1000" codecs="avc1.64001f" frameRate="30000/1001" height="360" id="0" width="640"></Representation>
+      <Representation bandwidth="4000" codecs="avc1.64001f" frameRate="60000/1001" height="1080" id="1" width="1920"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="3"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestFrom1080p := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="4000" codecs="avc1.64001f" frameRate="60000/1001" height="1080" id="1" width="1920"></Representation>
+    </AdaptationSet>
+    <AdaptationSet width="3840" height="2160" frameRate="60" id="1" contentType="video">
+      <Representation bandwidth="12000" codecs="hvc1.2.4.L153.90" id="2"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="3"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestUpTo30fps := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="1000" codecs="avc1.64001f" frameRate="30000/1001" height="360" id="0" width="640"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="3"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+	}{
+		{
+			name:                  "when no resolution or frame rate filter is given, the manifest is not modified",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestWithLadder,
+		},
+		{
+			name: "when a maximum resolution is given, representations above it are removed, reading the " +
+				"resolution from the adaptation set when the representation has none",
+			filters: &parsers.MediaFilters{Resolution: &parsers.ResolutionRange{
+				Max: parsers.Resolution{Width: 1920, Height: 1080},
+			}},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestUpTo1080p,
+		},
+		{
+			name: "when a minimum resolution is given, representations below it are removed",
+			filters: &parsers.MediaFilters{Resolution: &parsers.ResolutionRange{
+				Min: parsers.Resolution{Width: 1920, Height: 1080},
+				Max: parsers.Resolution{Width: math.MaxInt32, Height: math.MaxInt32},
+			}},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestFrom1080p,
+		},
+		{
+			name:                  "when a maximum frame rate is given, representations above it are removed",
+			filters:               &parsers.MediaFilters{FrameRate: &parsers.FrameRateRange{Max: 30}},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestUpTo30fps,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_videoRanges(t *testing.T) {
+	manifestWithVideoRanges := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="1000" codecs="avc1.64001f" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" contentType="video">
+      <SupplementalProperty schemeIdUri="urn:mpeg:mpegB:cicp:TransferCharacteristics" value="16"></SupplementalProperty>
+      <Representation bandwidth="4000" codecs="hvc1.2.4.L153.90" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" contentType="video">
+      <Representation bandwidth="4000" codecs="hvc1.2.4.L153.90" id="2">
+        <EssentialProperty schemeIdUri="urn:mpeg:mpegB:cicp:TransferCharacteristics" value="18"></EssentialProperty>
+      </Representation>
+      <Representation bandwidth="2000" codecs="hvc1.2.4.L153.90" id="3">
+        <EssentialProperty schemeIdUri="urn:mpeg:mpegB:cicp:TransferCharacteristics" value="1"></EssentialProperty>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet id="3" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="4"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithoutSDR := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <SupplementalProperty schemeIdUri="urn:mpeg:mpegB:cicp:TransferCharacteristics" value="16"></SupplementalProperty>
+      <Representation bandwidth="4000" codecs="hvc1.2.4.L153.90" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" contentType="video">
+      <Representation bandwidth="4000" codecs="hvc1.2.4.L153.90" id="2">
+        <EssentialProperty schemeIdUri="urn:mpeg:mpegB:cicp:TransferCharacteristics" value="18"></EssentialProperty>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="4"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithoutHDR := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="1000" codecs="avc1.64001f" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" contentType="video">
+      <Representation bandwidth="2000" codecs="hvc1.2.4.L153.90" id="3">
+        <EssentialProperty schemeIdUri="urn:mpeg:mpegB:cicp:TransferCharacteristics" value="1"></EssentialProperty>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="4"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithRepeatedDescriptors := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <SupplementalProperty schemeIdUri="urn:mpeg:mpegB:cicp:ColourPrimaries" value="9"></SupplementalProperty>
+      <SupplementalProperty schemeIdUri="urn:mpeg:mpegB:cicp:TransferCharacteristics" value="16"></SupplementalProperty>
+      <Representation bandwidth="4000" codecs="hvc1.2.4.L153.90" id="0">
+        <EssentialProperty schemeIdUri="urn:mpeg:mpegB:cicp:MatrixCoefficients" value="9"></EssentialProperty>
+        <BaseURL>hdr.mp4</BaseURL>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" contentType="video">
+      <SupplementalProperty schemeIdUri="urn:mpeg:mpegB:cicp:ColourPrimaries" value="1"></SupplementalProperty>
+      <Representation bandwidth="1000" codecs="avc1.64001f" id="1">
+        <BaseURL>sdr.mp4</BaseURL>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithRepeatedDescriptorsWithoutHDR := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <SupplementalProperty schemeIdUri="urn:mpeg:mpegB:cicp:ColourPrimaries" value="1"></SupplementalProperty>
+      <Representation bandwidth="1000" codecs="avc1.64001f" id="1">
+        <BaseURL>sdr.mp4</BaseURL>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+	}{
+		{
+			name:                  "when no video range filter is given, the manifest is not modified",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithVideoRanges,
+			expectManifestContent: manifestWithVideoRanges,
+		},
+		{
+			name: "when sdr is filtered, video representations without HDR transfer characteristics " +
+				"are removed",
+			filters:               &parsers.MediaFilters{VideoRanges: []parsers.VideoRange{"sdr"}},
+			manifestContent:       manifestWithVideoRanges,
+			expectManifestContent: manifestWithoutSDR,
+		},
+		{
+			name: "when pq and hlg are filtered, representations signaled as HDR on either the adaptation " +
+				"set or the representation are removed",
+			filters:               &parsers.MediaFilters{VideoRanges: []parsers.VideoRange{"pq", "hlg"}},
+			manifestContent:       manifestWithVideoRanges,
+			expectManifestContent: manifestWithoutHDR,
+		},
+		{
+			name:                  "when descriptors are repeated, they are all kept",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithRepeatedDescriptors,
+			expectManifestContent: manifestWithRepeatedDescriptors,
+		},
+		{
+			name: "when pq is filtered, the transfer characteristics are read among the other descriptors " +
+				"of the adaptation set",
+			filters:               &parsers.MediaFilters{VideoRanges: []parsers.VideoRange{"pq"}},
+			manifestContent:       manifestWithRepeatedDescriptors,
+			expectManifestContent: manifestWithRepeatedDescriptorsWithoutHDR,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_audioChannels(t *testing.T) {
+	manifestWithChannels := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="1000" codecs="avc1.64001f" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <AudioChannelConfiguration schemeIdUri="urn:mpeg:dash:23003:3:audio_channel_configuration:2011" value="2"></AudioChannelConfiguration>
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="audio">
+      <Representation bandwidth="384" codecs="ec-3" id="2">
+        <AudioChannelConfiguration schemeIdUri="tag:dolby.com,2014:dash:audio_channel_configuration:2011" value="F801"></AudioChannelConfiguration>
+      </Representation>
+      <Representation bandwidth="256" codecs="ac-3" id="3">
+        <AudioChannelConfiguration schemeIdUri="urn:mpeg:mpegB:cicp:ChannelConfiguration" value="6"></AudioChannelConfiguration>
+      </Representation>
+      <Representation bandwidth="96" codecs="ac-3" id="4">
+        <AudioChannelConfiguration schemeIdUri="urn:mpeg:mpegB:cicp:ChannelConfiguration" value="2"></AudioChannelConfiguration>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithStereoOnly := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="1000" codecs="avc1.64001f" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <AudioChannelConfiguration schemeIdUri="urn:mpeg:dash:23003:3:audio_channel_configuration:2011" value="2"></AudioChannelConfiguration>
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="audio">
+      <Representation bandwidth="96" codecs="ac-3" id="4">
+        <AudioChannelConfiguration schemeIdUri="urn:mpeg:mpegB:cicp:ChannelConfiguration" value="2"></AudioChannelConfiguration>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithSurroundOnly := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="1000" codecs="avc1.64001f" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="384" codecs="ec-3" id="2">
+        <AudioChannelConfiguration schemeIdUri="tag:dolby.com,2014:dash:audio_channel_configuration:2011" value="F801"></AudioChannelConfiguration>
+      </Representation>
+      <Representation bandwidth="256" codecs="ac-3" id="3">
+        <AudioChannelConfiguration schemeIdUri="urn:mpeg:mpegB:cicp:ChannelConfiguration" value="6"></AudioChannelConfiguration>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+	}{
+		{
+			name:                  "when no channel filter is given, the manifest is not modified",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithChannels,
+			expectManifestContent: manifestWithChannels,
+		},
+		{
+			name:                  "when a maximum of two channels is given, surround representations are removed",
+			filters:               &parsers.MediaFilters{AudioChannels: &parsers.ChannelRange{Max: 2}},
+			manifestContent:       manifestWithChannels,
+			expectManifestContent: manifestWithStereoOnly,
+		},
+		{
+			name: "when a minimum of three channels is given, stereo representations are removed along " +
+				"with the adaptation sets left empty",
+			filters:               &parsers.MediaFilters{AudioChannels: &parsers.ChannelRange{Min: 3, Max: math.MaxInt32}},
+			manifestContent:       manifestWithChannels,
+			expectManifestContent: manifestWithSurroundOnly,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_videoLevels(t *testing.T) {
+	manifestWithLevels := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="1000" codecs="avc1.64001f" id="0"></Representation>
+      <Representation bandwidth="4000" codecs="avc1.640032" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet codecs="hvc1.2.4.L156.B0" id="1" contentType="video">
+      <Representation bandwidth="12000" id="2"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="3"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithCappedLevels := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="1000" codecs="avc1.64001f" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="ac-3" id="3"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+	}{
+		{
+			name:                  "when no video level filter is given, the manifest is not modified",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithLevels,
+			expectManifestContent: manifestWithLevels,
+		},
+		{
+			name: "when maximum avc and hevc levels are given, representations above them are removed, " +
+				"reading the codecs from the adaptation set when the representation has none",
+			filters: &parsers.MediaFilters{VideoLevels: []parsers.VideoLevel{
+				{Codec: "avc", Level: 4.0},
+				{Codec: "hevc", Level: 5.1},
+			}},
+			manifestContent:       manifestWithLevels,
+			expectManifestContent: manifestWithCappedLevels,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_codecRegistry(t *testing.T) {
+	manifestWithNewCodecs := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="1000" codecs="avc1.64001f" id="0"></Representation>
+      <Representation bandwidth="2000" codecs="vp09.00.40.08" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="fLaC" id="2"></Representation>
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="3"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="text">
+      <Representation bandwidth="256" codecs="stpp.ttml.im1i" id="4"></Representation>
+      <Representation bandwidth="256" codecs="stpp.ttml.im1t" id="5"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithoutNewCodecs := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" contentType="video">
+      <Representation bandwidth="1000" codecs="avc1.64001f" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="3"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="text">
+      <Representation bandwidth="256" codecs="stpp.ttml.im1t" id="5"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+	}{
+		{
+			name: "when aliases of codecs from the codec registry are filtered, matching representations " +
+				"are removed",
+			filters: &parsers.MediaFilters{
+				Videos:       []parsers.VideoType{"vp9"},
+				Audios:       []parsers.AudioType{"flac"},
+				CaptionTypes: []parsers.CaptionType{"imsc-image"},
+			},
+			manifestContent:       manifestWithNewCodecs,
+			expectManifestContent: manifestWithoutNewCodecs,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_keepFilters(t *testing.T) {
+	manifestWithAllTracks := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="2048" codecs="avc1.640028" id="0"></Representation>
+      <Representation bandwidth="4096" codecs="hvc1.2.4.L153.B0" id="1"></Representation>
+      <Representation bandwidth="8192" codecs="dvh1.05.06" id="2"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="256" codecs="mp4a.40.2" id="0"></Representation>
+      <Representation bandwidth="384" codecs="ec-3" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="pt-BR" contentType="audio">
+      <Representation bandwidth="256" codecs="mp4a.40.2" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="3" lang="en" contentType="text">
+      <Representation bandwidth="256" codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="4" lang="pt-BR" contentType="text">
+      <Representation bandwidth="256" codecs="stpp" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithKeptCodecs := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="2048" codecs="avc1.640028" id="0"></Representation>
+      <Representation bandwidth="4096" codecs="hvc1.2.4.L153.B0" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="384" codecs="ec-3" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="text">
+      <Representation bandwidth="256" codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithKeptLanguages := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="2048" codecs="avc1.640028" id="0"></Representation>
+      <Representation bandwidth="4096" codecs="hvc1.2.4.L153.B0" id="1"></Representation>
+      <Representation bandwidth="8192" codecs="dvh1.05.06" id="2"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="pt-BR" contentType="audio">
+      <Representation bandwidth="256" codecs="mp4a.40.2" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="text">
+      <Representation bandwidth="256" codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+	}{
+		{
+			name: "when codecs to keep are given, only the representations with those codecs are kept",
+			filters: &parsers.MediaFilters{
+				KeepVideos:       []parsers.VideoType{"hevc", "avc"},
+				KeepAudios:       []parsers.AudioType{"ec-3"},
+				KeepCaptionTypes: []parsers.CaptionType{"wvtt"},
+			},
+			manifestContent:       manifestWithAllTracks,
+			expectManifestContent: manifestWithKeptCodecs,
+		},
+		{
+			name: "when languages to keep are given, only the adaptation sets in those languages are kept",
+			filters: &parsers.MediaFilters{
+				KeepAudioLanguages:   []parsers.AudioLanguage{"pt-br"},
+				KeepCaptionLanguages: []parsers.CaptionLanguage{"EN"},
+			},
+			manifestContent:       manifestWithAllTracks,
+			expectManifestContent: manifestWithKeptLanguages,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_trackBitrate(t *testing.T) {
+	manifestWithBitrates := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="400000" codecs="avc1.640028" id="0"></Representation>
+      <Representation bandwidth="2000000" codecs="avc1.640028" id="1"></Representation>
+      <Representation bandwidth="8000000" codecs="avc1.640028" id="2"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="64000" codecs="mp4a.40.5" id="0"></Representation>
+      <Representation bandwidth="384000" codecs="ec-3" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="text">
+      <Representation codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithTrackRanges := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="2000000" codecs="avc1.640028" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="64000" codecs="mp4a.40.5" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="text">
+      <Representation codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithVideoRange := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="2000000" codecs="avc1.640028" id="1"></Representation>
+      <Representation bandwidth="8000000" codecs="avc1.640028" id="2"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="64000" codecs="mp4a.40.5" id="0"></Representation>
+      <Representation bandwidth="384000" codecs="ec-3" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="text">
+      <Representation codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithoutLowBitrates := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="2000000" codecs="avc1.640028" id="1"></Representation>
+      <Representation bandwidth="8000000" codecs="avc1.640028" id="2"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="text">
+      <Representation codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+	}{
+		{
+			name: "when video and audio bitrate ranges are given, each applies to its own representations",
+			filters: &parsers.MediaFilters{
+				MaxBitrate:   math.MaxInt32,
+				VideoBitrate: &parsers.BitrateRange{Min: 500000, Max: 6000000},
+				AudioBitrate: &parsers.BitrateRange{Min: 0, Max: 256000},
+			},
+			manifestContent:       manifestWithBitrates,
+			expectManifestContent: manifestWithTrackRanges,
+		},
+		{
+			name: "when only a video bitrate range is given, audio representations are kept",
+			filters: &parsers.MediaFilters{
+				MaxBitrate:   math.MaxInt32,
+				VideoBitrate: &parsers.BitrateRange{Min: 500000, Max: math.MaxInt32},
+			},
+			manifestContent:       manifestWithBitrates,
+			expectManifestContent: manifestWithVideoRange,
+		},
+		{
+			name:                  "when a bitrate range is given without track type, audio representations below it are kept",
+			filters:               &parsers.MediaFilters{MinBitrate: 500000, MaxBitrate: math.MaxInt32},
+			manifestContent:       manifestWithBitrates,
+			expectManifestContent: manifestWithVideoRange,
+		},
+		{
+			name: "when a bitrate range is given, representations without bandwidth are kept",
+			filters: &parsers.MediaFilters{
+				MinBitrate:   500000,
+				MaxBitrate:   math.MaxInt32,
+				AudioBitrate: &parsers.BitrateRange{Min: 500000, Max: math.MaxInt32},
+			},
+			manifestContent:       manifestWithBitrates,
+			expectManifestContent: manifestWithoutLowBitrates,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_ladderSize(t *testing.T) {
+	manifestWithLadder := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="4000" codecs="avc1.640028" id="3"></Representation>
+      <Representation bandwidth="500" codecs="avc1.64001f" id="0"></Representation>
+      <Representation bandwidth="1000" codecs="avc1.64001f" id="1"></Representation>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="2"></Representation>
+      <Representation bandwidth="6000" codecs="avc1.640028" id="4"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="64" codecs="mp4a.40.5" id="0"></Representation>
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="text">
+      <Representation codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithTopRepresentations := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="4000" codecs="avc1.640028" id="3"></Representation>
+      <Representation bandwidth="6000" codecs="avc1.640028" id="4"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="64" codecs="mp4a.40.5" id="0"></Representation>
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="text">
+      <Representation codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithSpreadRepresentations := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="500" codecs="avc1.64001f" id="0"></Representation>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="2"></Representation>
+      <Representation bandwidth="6000" codecs="avc1.640028" id="4"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="64" codecs="mp4a.40.5" id="0"></Representation>
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="text">
+      <Representation codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithBottomRepresentation := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="500" codecs="avc1.64001f" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="64" codecs="mp4a.40.5" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="text">
+      <Representation codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+	}{
+		{
+			name: "when the ladder size is given, the highest representations of each adaptation set are kept",
+			filters: &parsers.MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				LadderSize: &parsers.LadderSize{Count: 2, Selection: parsers.LadderTop},
+			},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestWithTopRepresentations,
+		},
+		{
+			name: "when spread representations are asked for, they are evenly spread by bandwidth",
+			filters: &parsers.MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				LadderSize: &parsers.LadderSize{Count: 3, Selection: parsers.LadderSpread},
+			},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestWithSpreadRepresentations,
+		},
+		{
+			name: "when the bottom representation is asked for, representations without bandwidth are kept",
+			filters: &parsers.MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				LadderSize: &parsers.LadderSize{Count: 1, Selection: parsers.LadderBottom},
+			},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestWithBottomRepresentation,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_emptyPolicy(t *testing.T) {
+	manifestWithLadder := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="500" codecs="avc1.64001f" id="0"></Representation>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="1"></Representation>
+      <Representation bandwidth="6000" codecs="avc1.640028" id="2"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="64" codecs="mp4a.40.5" id="0"></Representation>
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="1"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="2" lang="en" contentType="text">
+      <Representation codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithTextOnly := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="text">
+      <Representation codecs="wvtt" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithClosestRepresentations := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period>
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="6000" codecs="avc1.640028" id="2"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="1"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	manifestWithLowestRepresentations := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0">
+    <AdaptationSet id="0" lang="en" contentType="video">
+      <Representation bandwidth="500" codecs="avc1.64001f" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" lang="en" contentType="audio">
+      <Representation bandwidth="64" codecs="mp4a.40.5" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectFallback        bool
+		expectErr             bool
+	}{
+		{
+			name: "when every audio and video representation is filtered with the error policy, an error is returned",
+			filters: &parsers.MediaFilters{
+				MinBitrate:   10000,
+				MaxBitrate:   20000,
+				AudioBitrate: &parsers.BitrateRange{Min: 1000, Max: 2000},
+				EmptyPolicy:  parsers.EmptyPolicyError,
+			},
+			manifestContent: manifestWithLadder,
+			expectErr:       true,
+		},
+		{
+			name: "when every audio and video representation is filtered, the period is left without them " +
+				"by default",
+			filters: &parsers.MediaFilters{
+				MinBitrate:   10000,
+				MaxBitrate:   20000,
+				AudioBitrate: &parsers.BitrateRange{Min: 1000, Max: 2000},
+			},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestWithTextOnly,
+		},
+		{
+			name: "when every audio and video representation is filtered with a fallback, the representations " +
+				"closest to the bitrate range are kept",
+			filters: &parsers.MediaFilters{
+				MinBitrate:   10000,
+				MaxBitrate:   20000,
+				AudioBitrate: &parsers.BitrateRange{Min: 1000, Max: 2000},
+				EmptyPolicy:  parsers.EmptyPolicyFallback,
+			},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestWithClosestRepresentations,
+			expectFallback:        true,
+		},
+		{
+			name: "when the audio and video adaptation sets are filtered with a fallback, the lowest " +
+				"representations are kept",
+			filters: &parsers.MediaFilters{
+				MaxBitrate:        math.MaxInt32,
+				FilterStreamTypes: []parsers.StreamType{"video", "audio"},
+				EmptyPolicy:       parsers.EmptyPolicyFallback,
+			},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestWithLowestRepresentations,
+			expectFallback:        true,
+		},
+		{
+			name: "when audio is left, the fallback is not used",
+			filters: &parsers.MediaFilters{
+				MaxBitrate:        math.MaxInt32,
+				FilterStreamTypes: []parsers.StreamType{"video", "text"},
+				EmptyPolicy:       parsers.EmptyPolicyFallback,
+			},
+			manifestContent: manifestWithLadder,
+			expectManifestContent: `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-on-demand:2011" type="static" mediaPresentationDuration="PT6M16S" minBufferTime="PT1.97S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0">
+    <AdaptationSet id="0" lang="en" contentType="audio">
+      <Representation bandwidth="64" codecs="mp4a.40.5" id="0"></Representation>
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="1"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := filter.UsedFallback(), tt.expectFallback; g != e {
+				t.Errorf("UsedFallback() wrong value returned\ngot %v\nexpected: %v", g, e)
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestDASHFilter_FilterManifest_trim(t *testing.T) {
+	liveManifest := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="dynamic" minBufferTime="PT2S" availabilityStartTime="2020-03-11T00:00:00Z" minimumUpdatePeriod="PT2S" timeShiftBufferDepth="PT30S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0" start="PT0S">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate presentationTimeOffset="900000" initialization="video_init.mp4" media="video_$Time$.mp4" timescale="90000">
+        <SegmentTimeline>
+          <S t="900000" d="180000" r="9"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" contentType="audio">
+      <SegmentTemplate presentationTimeOffset="480000" initialization="audio_init.mp4" media="audio_$Time$.mp4" timescale="48000">
+        <SegmentTimeline>
+          <S t="480000" d="96000" r="-1"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	liveManifestTrimmed := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" mediaPresentationDuration="PT8S" minBufferTime="PT2S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0" duration="PT8S" start="PT0S">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate presentationTimeOffset="1260000" initialization="video_init.mp4" media="video_$Time$.mp4" timescale="90000">
+        <SegmentTimeline>
+          <S t="1260000" d="180000" r="3"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" contentType="audio">
+      <SegmentTemplate presentationTimeOffset="672000" initialization="audio_init.mp4" media="audio_$Time$.mp4" timescale="48000">
+        <SegmentTimeline>
+          <S t="672000" d="96000" r="3"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	liveManifestTrimmedBeforeEnd := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="dynamic" mediaPresentationDuration="PT20S" minBufferTime="PT2S" availabilityStartTime="2020-03-11T00:00:00Z" minimumUpdatePeriod="PT2S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0" start="PT4S">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate presentationTimeOffset="1260000" initialization="video_init.mp4" media="video_$Time$.mp4" timescale="90000">
+        <SegmentTimeline>
+          <S t="1260000" d="180000" r="2"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" contentType="audio">
+      <SegmentTemplate presentationTimeOffset="672000" initialization="audio_init.mp4" media="audio_$Time$.mp4" timescale="48000">
+        <SegmentTimeline>
+          <S t="672000" d="96000" r="2"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="128" codecs="mp4a.40.2" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	vodManifestWithNumberTemplate := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" mediaPresentationDuration="PT20S" minBufferTime="PT2S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate duration="2" initialization="video_init.mp4" media="video_$Number$.mp4" startNumber="1" timescale="1"></SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	vodManifestTrimmed := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" mediaPresentationDuration="PT4S" minBufferTime="PT2S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0" duration="PT4S" start="PT0S">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate presentationTimeOffset="6" duration="2" initialization="video_init.mp4" media="video_$Number$.mp4" startNumber="4" timescale="1"></SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	vodManifestTrimmedInside := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" mediaPresentationDuration="PT2S" minBufferTime="PT2S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0" duration="PT2S" start="PT0S">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate presentationTimeOffset="6" duration="2" initialization="video_init.mp4" media="video_$Number$.mp4" startNumber="4" timescale="1"></SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	numberTimelineManifest := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" mediaPresentationDuration="PT20S" minBufferTime="PT2S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate initialization="video_init.mp4" media="video_$Number$.mp4" startNumber="10" timescale="1">
+        <SegmentTimeline>
+          <S t="0" d="2" r="9"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	numberTimelineManifestTrimmed := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" mediaPresentationDuration="PT4S" minBufferTime="PT2S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0" duration="PT4S" start="PT0S">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate presentationTimeOffset="6" initialization="video_init.mp4" media="video_$Number$.mp4" startNumber="13" timescale="1">
+        <SegmentTimeline>
+          <S t="6" d="2" r="1"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	zeroDurationTimelineManifest := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" mediaPresentationDuration="PT20S" minBufferTime="PT2S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate initialization="video_init.mp4" media="video_$Time$.mp4" timescale="1">
+        <SegmentTimeline>
+          <S t="0" d="0" r="-1"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	unboundedManifest := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" minBufferTime="PT2S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate initialization="video_init.mp4" media="video_$Number$.mp4" duration="2" timescale="1"></SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	multiPeriodManifest := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" mediaPresentationDuration="PT20S" minBufferTime="PT2S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0" start="PT0S">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate initialization="p0_init.mp4" media="p0_$Time$.mp4" timescale="1">
+        <SegmentTimeline>
+          <S t="0" d="2" r="4"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+  <Period id="1" start="PT10S">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate initialization="p1_init.mp4" media="p1_$Time$.mp4" timescale="1">
+        <SegmentTimeline>
+          <S t="0" d="2" r="4"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	multiPeriodManifestTrimmedWithOverlap := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" mediaPresentationDuration="PT6S" minBufferTime="PT2S">
+  <BaseURL>http://existing.base/url/</BaseURL>
+  <Period id="0" duration="PT2S" start="PT0S">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate presentationTimeOffset="8" initialization="p0_init.mp4" media="p0_$Time$.mp4" timescale="1">
+        <SegmentTimeline>
+          <S t="8" d="2"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+  <Period id="1" duration="PT4S" start="PT2S">
+    <AdaptationSet id="0" contentType="video">
+      <SegmentTemplate presentationTimeOffset="0" initialization="p1_init.mp4" media="p1_$Time$.mp4" timescale="1">
+        <SegmentTimeline>
+          <S t="0" d="2" r="1"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation bandwidth="2000" codecs="avc1.640028" id="0"></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		now                   time.Time
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name: "when trimming a live manifest after the live edge, a dynamic manifest with the segments " +
+				"available so far and ending with the trim is returned",
+			filters: &parsers.MediaFilters{
+				Trim: &parsers.Trim{Start: 1583884804, End: 1583884820}, // 2020-03-11T00:00:04 to 00:00:20
+			},
+			now:                   time.Date(2020, 3, 11, 0, 0, 11, 0, time.UTC),
+			manifestContent:       liveManifest,
+			expectManifestContent: liveManifestTrimmedBeforeEnd,
+		},
+		{
+			name: "when trimming a live manifest, a static manifest with the segments starting within the " +
+				"trim is returned",
+			filters: &parsers.MediaFilters{
+				Trim: &parsers.Trim{Start: 1583884804, End: 1583884810}, // 2020-03-11T00:00:04 to 00:00:10
+			},
+			manifestContent:       liveManifest,
+			expectManifestContent: liveManifestTrimmed,
+		},
+		{
+			name:            "when trimming by time a manifest without availability start time, an error is returned",
+			filters:         &parsers.MediaFilters{Trim: &parsers.Trim{Start: 1583884804, End: 1583884810}},
+			manifestContent: vodManifestWithNumberTemplate,
+			expectErr:       true,
+		},
+		{
+			name:                  "when trimming by offset a number template, the presentation time offset and start number are moved",
+			filters:               &parsers.MediaFilters{Trim: &parsers.Trim{Start: 5, End: 9, Offset: true}},
+			manifestContent:       vodManifestWithNumberTemplate,
+			expectManifestContent: vodManifestTrimmed,
+		},
+		{
+			name: "when trimming by offset inside boundaries, only segments entirely in the trim are kept",
+			filters: &parsers.MediaFilters{
+				Trim: &parsers.Trim{Start: 5, End: 9, Offset: true, Boundary: parsers.TrimInside},
+			},
+			manifestContent:       vodManifestWithNumberTemplate,
+			expectManifestContent: vodManifestTrimmedInside,
+		},
+		{
+			name:                  "when trimming by offset a numbered timeline, the start number skips the dropped segments",
+			filters:               &parsers.MediaFilters{Trim: &parsers.Trim{Start: 5, End: 9, Offset: true}},
+			manifestContent:       numberTimelineManifest,
+			expectManifestContent: numberTimelineManifestTrimmed,
+		},
+		{
+			name:            "when trimming a timeline with a zero segment duration, an error is returned",
+			filters:         &parsers.MediaFilters{Trim: &parsers.Trim{Start: 5, End: 9, Offset: true}},
+			manifestContent: zeroDurationTimelineManifest,
+			expectErr:       true,
+		},
+		{
+			name: "when trimming a static manifest whose end is unknown, an error is returned instead of " +
+				"going through its segments up to the end of the trim",
+			filters:         &parsers.MediaFilters{Trim: &parsers.Trim{Start: 0, End: 1099511627776, Offset: true}},
+			manifestContent: unboundedManifest,
+			expectErr:       true,
+		},
+		{
+			name: "when trimming across periods, each period keeps its segments and starts after the previous one",
+			filters: &parsers.MediaFilters{
+				Trim: &parsers.Trim{Start: 8, End: 12, Offset: true, Boundary: parsers.TrimOverlap},
+			},
+			manifestContent:       multiPeriodManifest,
+			expectManifestContent: multiPeriodManifestTrimmedWithOverlap,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.now.IsZero() {
+				defer func(n func() time.Time) { now = n }(now)
+				now = func() time.Time { return tt.now }
+			}
+
+			filter := NewDASHFilter("", tt.manifestContent, config.Config{})
+
+			manifest, err := filter.FilterManifest(tt.filters)
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
@@ -1,13 +1,22 @@
 package filters
 
 import (
-	"github.com/cbsinteractive/bakery/pkg/parsers"
+	"errors"
+	"math"
+	"sort"
 	"strings"
+
+	"github.com/cbsinteractive/bakery/pkg/parsers"
 )
 
+// ErrNoPlayableVariant is returned when the filters remove every playable variant of
+// the manifest and the request asked to fail with the error policy
+var ErrNoPlayableVariant = errors.New("the filters removed every playable variant")
+
 // Filter is an interface for HLS and DASH filters
 type Filter interface {
 	FilterManifest(filters *parsers.MediaFilters) (string, error)
+	UsedFallback() bool
 }
 
 // ContentType represents the content in the stream
@@ -19,41 +28,80 @@ const (
 	videoContentType   ContentType = "video"
 )
 
-// CodecFilterID is the formatted codec represented in a given playlist
-type CodecFilterID string
-
 const (
-	hevcCodec  CodecFilterID = "hvc"
-	avcCodec   CodecFilterID = "avc"
-	dolbyCodec CodecFilterID = "dvh"
-	aacCodec   CodecFilterID = "mp4a"
-	ec3Codec   CodecFilterID = "ec-3"
-	ac3Codec   CodecFilterID = "ac-3"
-	stppCodec  CodecFilterID = "stpp"
-	wvttCodec  CodecFilterID = "wvtt"
+	sdrVideoRange parsers.VideoRange = "sdr"
+	pqVideoRange  parsers.VideoRange = "pq"
+	hlgVideoRange parsers.VideoRange = "hlg"
 )
 
-// ValidCodecs returns a map of all formatted values for a given codec filter
+// CodecFilterID is the formatted codec represented in a given playlist
+type CodecFilterID string
+
+// ValidCodecs returns true if the codec string starts with the given codec filter, so
+// that a filter only matches the sample entry (and profile) of a codec and not its level
 func ValidCodecs(codec string, filter CodecFilterID) bool {
-	return strings.Contains(codec, string(filter))
+	return hasCodecPrefix(strings.TrimSpace(codec), string(filter))
+}
+
+// hasCodecPrefix returns true if the codec string starts with the prefix followed by a
+// dot or nothing, so that mp4a.40.2 does not match mp4a.40.29
+func hasCodecPrefix(codec, prefix string) bool {
+	return codec == prefix || strings.HasPrefix(codec, prefix+".")
 }
 
-// Returns true if given codec is an audio codec (mp4a, ec-3, or ac-3)
-func isAudioCodec(codec string) bool {
-	return (ValidCodecs(codec, aacCodec) ||
-		ValidCodecs(codec, ec3Codec) ||
-		ValidCodecs(codec, ac3Codec))
+// selectLadder returns the indexes of the bandwidths kept when the ladder is limited to
+// the given size
+func selectLadder(bandwidths []int64, size parsers.LadderSize) map[int]struct{} {
+	sorted := make([]int, len(bandwidths))
+	for i := range sorted {
+		sorted[i] = i
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return bandwidths[sorted[i]] < bandwidths[sorted[j]]
+	})
+
+	count := size.Count
+	if count > len(sorted) {
+		count = len(sorted)
+	}
+
+	var selected []int
+	switch {
+	case count == len(sorted):
+		selected = sorted
+	case size.Selection == parsers.LadderBottom:
+		selected = sorted[:count]
+	case size.Selection == parsers.LadderSpread && count > 1:
+		for i := 0; i < count; i++ {
+			position := math.Round(float64(i*(len(sorted)-1)) / float64(count-1))
+			selected = append(selected, sorted[int(position)])
+		}
+	default:
+		selected = sorted[len(sorted)-count:]
+	}
+
+	kept := map[int]struct{}{}
+	for _, i := range selected {
+		kept[i] = struct{}{}
+	}
+
+	return kept
 }
 
-// Returns true if given codec is a video codec (hvc, avc, or dvh)
-func isVideoCodec(codec string) bool {
-	return (ValidCodecs(codec, hevcCodec) ||
-		ValidCodecs(codec, avcCodec) ||
-		ValidCodecs(codec, dolbyCodec))
+// inTrim returns true if the segment spanning from start to end, in seconds, is kept by
+// the trim according to the way it handles the segments crossing its boundaries
+func inTrim(trim *parsers.Trim, start, end float64) bool {
+	trimStart, trimEnd := float64(trim.Start), float64(trim.End)
+	switch trim.Boundary {
+	case parsers.TrimOverlap:
+		return start <= trimEnd && end > trimStart
+	case parsers.TrimInside:
+		return start >= trimStart && end <= trimEnd
+	}
+
+	return inRange(trimStart, trimEnd, start)
 }
 
-// Returns true if goven codec is a caption codec (stpp or wvtt)
-func isCaptionCodec(codec string) bool {
-	return (ValidCodecs(codec, stppCodec) ||
-		ValidCodecs(codec, wvttCodec))
+func inRange(start float64, end float64, value float64) bool {
+	return (start <= value) && (value <= end)
 }
@@ -4,8 +4,12 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"math"
 	"net/url"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,12 +26,48 @@ type HLSFilter struct {
 	manifestURL     string
 	manifestContent string
 	config          config.Config
+	codecs          *CodecRegistry
+	usedFallback    bool
 }
 
-var matchFunctions = map[ContentType]func(string) bool{
-	audioContentType:   isAudioCodec,
-	videoContentType:   isVideoCodec,
-	captionContentType: isCaptionCodec,
+// audioDescriptionCharacteristic marks EXT-X-MEDIA renditions that describe the video
+const audioDescriptionCharacteristic = "public.accessibility.describes-video"
+
+var (
+	attributeListRegexp = regexp.MustCompile(`([A-Z0-9-]+)=("[^"]*"|[^",]*)`)
+	tagURIRegexp        = regexp.MustCompile(`URI="([^"]*)"`)
+)
+
+// encodedMasterTags are the master playlist tags written by the m3u8 library
+var encodedMasterTags = map[string]struct{}{
+	"#EXTM3U":                     {},
+	"#EXT-X-VERSION":              {},
+	"#EXT-X-INDEPENDENT-SEGMENTS": {},
+	"#EXT-X-MEDIA":                {},
+	"#EXT-X-STREAM-INF":           {},
+	"#EXT-X-I-FRAME-STREAM-INF":   {},
+}
+
+// encodedAlternativeAttributes are the EXT-X-MEDIA attributes written by the m3u8 library
+var encodedAlternativeAttributes = map[string]struct{}{
+	"TYPE":            {},
+	"GROUP-ID":        {},
+	"NAME":            {},
+	"DEFAULT":         {},
+	"AUTOSELECT":      {},
+	"LANGUAGE":        {},
+	"FORCED":          {},
+	"CHARACTERISTICS": {},
+	"SUBTITLES":       {},
+	"URI":             {},
+}
+
+// renditionContentTypes maps the EXT-X-MEDIA rendition types to the content they carry
+var renditionContentTypes = map[string]ContentType{
+	"AUDIO":           audioContentType,
+	"VIDEO":           videoContentType,
+	"SUBTITLES":       captionContentType,
+	"CLOSED-CAPTIONS": captionContentType,
 }
 
 // NewHLSFilter is the HLS filter constructor
@@ -36,6 +76,7 @@ func NewHLSFilter(manifestURL, manifestContent string, c config.Config) *HLSFilt
 		manifestURL:     manifestURL,
 		manifestContent: manifestContent,
 		config:          c,
+		codecs:          NewCodecRegistry(c.Codecs),
 	}
 }
 
@@ -54,57 +95,814 @@ func (h *HLSFilter) FilterManifest(filters *parsers.MediaFilters) (string, error
 	// convert into the master playlist type
 	manifest := m.(*m3u8.MasterPlaylist)
 	filteredManifest := m3u8.NewMasterPlaylist()
+	filteredManifest.SetVersion(manifest.Version())
+	filteredManifest.SetIndependentSegments(manifest.IndependentSegments())
 
-	for _, v := range manifest.Variants {
-		absolute, aErr := getAbsoluteURL(h.manifestURL)
-		if aErr != nil {
-			return h.manifestContent, aErr
+	absolute, aErr := getAbsoluteURL(h.manifestURL)
+	if aErr != nil {
+		return h.manifestContent, aErr
+	}
+
+	h.usedFallback = false
+	filteredVariants, alternatives, err := h.filterVariants(filters, manifest.Variants, *absolute)
+	if err != nil {
+		return "", err
+	}
+
+	if !hasPlayableVariant(filteredVariants) && hasPlayableVariant(manifest.Variants) {
+		// without a policy, the manifest is served as the filters left it
+		switch filters.EmptyPolicy {
+		case parsers.EmptyPolicyError:
+			return "", ErrNoPlayableVariant
+		case parsers.EmptyPolicyFallback:
+			filteredVariants, alternatives, err = h.fallbackVariants(filters, *absolute)
+			if err != nil {
+				return "", err
+			}
+			h.usedFallback = true
 		}
+	}
 
-		normalizedVariant, err := h.normalizeVariant(v, *absolute)
+	for i, v := range filteredVariants {
+		// the encoder writes the EXT-X-MEDIA tags of each variant before it, so all
+		// the remaining renditions are carried by the first variant
+		v.Alternatives = nil
+		if i == 0 {
+			v.Alternatives = alternatives
+		}
+
+		filteredManifest.Append(v.URI, v.Chunklist, v.VariantParams)
+	}
+
+	return h.restoreMasterTags(filteredManifest.String(), *absolute)
+}
+
+// filterVariants returns the variants and the EXT-X-MEDIA renditions left once the
+// filters are applied, normalized against the manifest url
+func (h *HLSFilter) filterVariants(filters *parsers.MediaFilters, variants []*m3u8.Variant, absolute url.URL) ([]*m3u8.Variant, []*m3u8.Alternative, error) {
+	originalGroups := referencedGroups(variants)
+	alternatives, emptiedGroups := h.filterAlternatives(filters, variants)
+	if isStreamTypeFiltered(filters, videoContentType) {
+		variants = h.addAudioOnlyVariants(variants, alternatives)
+	}
+
+	var filteredVariants []*m3u8.Variant
+	for _, v := range variants {
+		h.clearFilteredStreamTypes(filters, v)
+		if referencesEmptiedGroup(v, emptiedGroups) {
+			continue
+		}
+		clearEmptiedGroups(v, emptiedGroups)
+
+		normalizedVariant, err := h.normalizeVariant(v, absolute)
 		if err != nil {
-			return "", err
+			return nil, nil, err
 		}
 
 		validatedFilters, err := h.validateVariants(filters, normalizedVariant)
 		if err != nil {
-			return "", err
+			return nil, nil, err
 		}
 
 		if validatedFilters {
 			continue
 		}
 
-		uri := normalizedVariant.URI
 		if filters.Trim != nil {
-			uri, err = h.normalizeTrimmedVariant(filters, uri)
+			normalizedVariant.URI, err = h.normalizeTrimmedVariant(filters, normalizedVariant.URI)
 			if err != nil {
-				return "", err
+				return nil, nil, err
+			}
+		}
+
+		filteredVariants = append(filteredVariants, normalizedVariant)
+	}
+
+	if filters.LadderSize != nil {
+		filteredVariants = limitLadders(filteredVariants, *filters.LadderSize)
+	}
+
+	alternatives = pruneAlternatives(alternatives, originalGroups, referencedGroups(filteredVariants))
+	if err := normalizeAlternatives(alternatives, absolute); err != nil {
+		return nil, nil, err
+	}
+
+	return filteredVariants, alternatives, nil
+}
+
+// fallbackVariants returns the playable variant of the origin manifest whose bandwidth
+// is the closest to the bitrate filters, along with its renditions. The lowest bandwidth
+// wins ties, so that the variant most likely to play is served when no bitrate is given
+func (h *HLSFilter) fallbackVariants(filters *parsers.MediaFilters, absolute url.URL) ([]*m3u8.Variant, []*m3u8.Alternative, error) {
+	m, _, err := m3u8.DecodeFrom(strings.NewReader(h.manifestContent), true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// renditions are attached to the variant following them, so they are gathered
+	// before being handed to the fallback variant
+	var fallback *m3u8.Variant
+	var fallbackDistance int
+	var alternatives []*m3u8.Alternative
+	for _, v := range m.(*m3u8.MasterPlaylist).Variants {
+		alternatives = append(alternatives, v.Alternatives...)
+		v.Alternatives = nil
+		if v.Iframe {
+			continue
+		}
+
+		distance := h.bitrateDistance(filters, v)
+		if fallback == nil || distance < fallbackDistance ||
+			(distance == fallbackDistance && v.Bandwidth < fallback.Bandwidth) {
+			fallback, fallbackDistance = v, distance
+		}
+	}
+
+	groups := referencedGroups([]*m3u8.Variant{fallback})
+	for _, a := range alternatives {
+		if _, found := groups[alternativeGroup{renditionType: a.Type, groupID: a.GroupId}]; found {
+			fallback.Alternatives = append(fallback.Alternatives, a)
+		}
+	}
+
+	// the trim is the only filter kept, as it does not remove any variant
+	return h.filterVariants(&parsers.MediaFilters{MaxBitrate: math.MaxInt32, Trim: filters.Trim}, []*m3u8.Variant{fallback}, absolute)
+}
+
+// bitrateDistance returns how far the variant bandwidth is from the bitrate ranges of
+// the filters, 0 meaning the variant is within them
+func (h *HLSFilter) bitrateDistance(filters *parsers.MediaFilters, v *m3u8.Variant) int {
+	bw := variantBandwidth(filters, v)
+	variantCodecs := strings.Split(v.Codecs, ",")
+
+	var distance int
+	if !h.variantIsAudioOnly(v, variantCodecs) {
+		overall := parsers.BitrateRange{Min: filters.MinBitrate, Max: filters.MaxBitrate}
+		distance = overall.Distance(bw)
+	}
+
+	switch {
+	case filters.VideoBitrate != nil && h.variantHasVideo(v, variantCodecs):
+		distance += filters.VideoBitrate.Distance(bw)
+	case filters.AudioBitrate != nil && h.variantHasAudio(variantCodecs):
+		distance += filters.AudioBitrate.Distance(bw)
+	}
+
+	return distance
+}
+
+// UsedFallback returns true if the last filtered manifest was served with the fallback
+// variant, as the filters removed every playable one
+func (h *HLSFilter) UsedFallback() bool {
+	return h.usedFallback
+}
+
+// hasPlayableVariant returns true if any of the variants is not an I-frame one
+func hasPlayableVariant(variants []*m3u8.Variant) bool {
+	for _, v := range variants {
+		if !v.Iframe {
+			return true
+		}
+	}
+
+	return false
+}
+
+// restoreMasterTags adds back the master playlist tags and EXT-X-MEDIA attributes the
+// m3u8 library does not model, such as EXT-X-SESSION-KEY or CHANNELS. The tags are
+// written right after the playlist header in the order they appear in the origin
+func (h *HLSFilter) restoreMasterTags(filteredManifest string, absolute url.URL) (string, error) {
+	var preservedTags []string
+	extraAttributes := map[string]string{}
+	for _, line := range strings.Split(h.manifestContent, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#EXT") {
+			continue
+		}
+
+		tag := strings.SplitN(line, ":", 2)[0]
+		if tag == "#EXT-X-MEDIA" {
+			key, extra := alternativeAttributes(line)
+			if extra != "" {
+				extraAttributes[key] = extra
+			}
+			continue
+		}
+
+		if _, encoded := encodedMasterTags[tag]; encoded {
+			continue
+		}
+
+		normalizedTag, err := normalizeTagURI(line, absolute)
+		if err != nil {
+			return "", fmt.Errorf("restoring master playlist tags: %w", err)
+		}
+		preservedTags = append(preservedTags, normalizedTag)
+	}
+
+	var lines []string
+	inHeader := true
+	for _, line := range strings.Split(filteredManifest, "\n") {
+		if inHeader && !isMasterHeader(line) {
+			lines = append(lines, preservedTags...)
+			inHeader = false
+		}
+
+		if strings.HasPrefix(line, "#EXT-X-MEDIA:") {
+			if key, _ := alternativeAttributes(line); extraAttributes[key] != "" {
+				line += "," + extraAttributes[key]
+			}
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// Returns true if the line is one of the header tags written by the m3u8 library
+func isMasterHeader(line string) bool {
+	return line == "#EXTM3U" || line == "#EXT-X-INDEPENDENT-SEGMENTS" || strings.HasPrefix(line, "#EXT-X-VERSION:")
+}
+
+// alternativeAttributes returns the key the m3u8 library uses to tell EXT-X-MEDIA tags
+// apart, along with the raw attributes of the tag the library does not encode
+func alternativeAttributes(line string) (string, string) {
+	attributes := strings.TrimPrefix(line, "#EXT-X-MEDIA:")
+	params := m3u8.DecodeAttributeList(attributes)
+	key := alternativeKey(params["TYPE"], params["GROUP-ID"], params["NAME"], params["LANGUAGE"])
+
+	var extra []string
+	for _, attribute := range attributeListRegexp.FindAllStringSubmatch(attributes, -1) {
+		if _, encoded := encodedAlternativeAttributes[attribute[1]]; !encoded {
+			extra = append(extra, attribute[0])
+		}
+	}
+
+	return key, strings.Join(extra, ",")
+}
+
+// alternativeKey builds the key the m3u8 library uses to tell EXT-X-MEDIA tags apart
+func alternativeKey(renditionType, groupID, name, language string) string {
+	return fmt.Sprintf("%s-%s-%s-%s", renditionType, groupID, name, language)
+}
+
+// alternativeAttribute reads an attribute of the EXT-X-MEDIA tags which the m3u8 library
+// does not decode, keyed by alternativeKey. Tags without the attribute are left out
+func (h *HLSFilter) alternativeAttribute(name string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(h.manifestContent, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#EXT-X-MEDIA:") {
+			continue
+		}
+
+		params := m3u8.DecodeAttributeList(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+		if value, found := params[name]; found {
+			values[alternativeKey(params["TYPE"], params["GROUP-ID"], params["NAME"], params["LANGUAGE"])] = value
+		}
+	}
+
+	return values
+}
+
+// alternativeChannels reads the CHANNELS attribute of the EXT-X-MEDIA tags, keyed by
+// alternativeKey
+func (h *HLSFilter) alternativeChannels() map[string]int {
+	channels := map[string]int{}
+	for key, value := range h.alternativeAttribute("CHANNELS") {
+		// the first parameter of CHANNELS is the channel count, e.g. "16/JOC"
+		count, err := strconv.Atoi(strings.SplitN(value, "/", 2)[0])
+		if err != nil {
+			continue
+		}
+
+		channels[key] = count
+	}
+
+	return channels
+}
+
+// groupCodecs returns, for each AUDIO and SUBTITLES group, the codecs of its content type
+// listed by each variant referencing it, as the renditions seldom advertise their own
+func (h *HLSFilter) groupCodecs(variants []*m3u8.Variant) map[alternativeGroup][][]string {
+	codecs := map[alternativeGroup][][]string{}
+	for _, v := range variants {
+		groups := map[alternativeGroup]ContentType{
+			{renditionType: "AUDIO", groupID: v.Audio}:         audioContentType,
+			{renditionType: "SUBTITLES", groupID: v.Subtitles}: captionContentType,
+		}
+
+		for group, ct := range groups {
+			if group.groupID == "" {
+				continue
+			}
+
+			var variantCodecs []string
+			for _, codec := range strings.Split(v.Codecs, ",") {
+				if h.codecs.matchFunctions()[ct](codec) {
+					variantCodecs = append(variantCodecs, strings.TrimSpace(codec))
+				}
+			}
+
+			if len(variantCodecs) > 0 {
+				codecs[group] = append(codecs[group], variantCodecs)
+			}
+		}
+	}
+
+	return codecs
+}
+
+// normalizeTagURI makes the URI attribute of a tag absolute
+func normalizeTagURI(line string, absolute url.URL) (string, error) {
+	match := tagURIRegexp.FindStringSubmatchIndex(line)
+	if match == nil {
+		return line, nil
+	}
+
+	uri, err := combinedIfRelative(line[match[2]:match[3]], absolute)
+	if err != nil {
+		return "", err
+	}
+
+	return line[:match[2]] + uri + line[match[3]:], nil
+}
+
+// alternativeGroup identifies an EXT-X-MEDIA group by rendition type and GROUP-ID
+type alternativeGroup struct {
+	renditionType string
+	groupID       string
+}
+
+// filterAlternatives detaches the EXT-X-MEDIA renditions from every variant and returns
+// the ones not matching the filters, along with the groups left without any rendition
+func (h *HLSFilter) filterAlternatives(filters *parsers.MediaFilters, variants []*m3u8.Variant) ([]*m3u8.Alternative, map[alternativeGroup]struct{}) {
+	var filteredAlternatives []*m3u8.Alternative
+	remaining := map[alternativeGroup]int{}
+	seen := map[*m3u8.Alternative]struct{}{}
+	channels := h.alternativeChannels()
+	renditionCodecs := h.alternativeAttribute("CODECS")
+	groupCodecs := h.groupCodecs(variants)
+	for _, v := range variants {
+		for _, a := range v.Alternatives {
+			if _, found := seen[a]; found {
+				continue
+			}
+			seen[a] = struct{}{}
+
+			group := alternativeGroup{renditionType: a.Type, groupID: a.GroupId}
+			if _, found := remaining[group]; !found {
+				remaining[group] = 0
+			}
+
+			// renditions advertising their own codecs are filtered on them rather than on the
+			// codecs of their group
+			key := alternativeKey(a.Type, a.GroupId, a.Name, a.Language)
+			codecs := groupCodecs[group]
+			if rendition, found := renditionCodecs[key]; found {
+				codecs = [][]string{strings.Split(rendition, ",")}
+			}
+
+			if h.validateAlternative(filters, a, channels[key], codecs) {
+				continue
+			}
+
+			remaining[group]++
+			filteredAlternatives = append(filteredAlternatives, a)
+		}
+		v.Alternatives = nil
+	}
+
+	emptiedGroups := map[alternativeGroup]struct{}{}
+	for group, count := range remaining {
+		if count == 0 {
+			emptiedGroups[group] = struct{}{}
+		}
+	}
+
+	return filteredAlternatives, emptiedGroups
+}
+
+// limitLadders keeps, for each ladder of variants sharing the same codecs, the variants
+// picked by the ladder size. The order of the variants is preserved
+func limitLadders(variants []*m3u8.Variant, size parsers.LadderSize) []*m3u8.Variant {
+	ladders := map[string][]int{}
+	for i, v := range variants {
+		key := ladderKey(v)
+		ladders[key] = append(ladders[key], i)
+	}
+
+	kept := map[int]struct{}{}
+	for _, ladder := range ladders {
+		bandwidths := make([]int64, len(ladder))
+		for i, variantIndex := range ladder {
+			bandwidths[i] = int64(variants[variantIndex].Bandwidth)
+		}
+
+		for i := range selectLadder(bandwidths, size) {
+			kept[ladder[i]] = struct{}{}
+		}
+	}
+
+	var limitedVariants []*m3u8.Variant
+	for i, v := range variants {
+		if _, found := kept[i]; found {
+			limitedVariants = append(limitedVariants, v)
+		}
+	}
+
+	return limitedVariants
+}
+
+// ladderKey identifies the ladder of a variant by the sample entries of its codecs, such
+// as avc1 or mp4a, with I-frame variants making up ladders of their own
+func ladderKey(v *m3u8.Variant) string {
+	var sampleEntries []string
+	for _, codec := range strings.Split(v.Codecs, ",") {
+		sampleEntries = append(sampleEntries, strings.SplitN(strings.TrimSpace(codec), ".", 2)[0])
+	}
+	sort.Strings(sampleEntries)
+
+	return fmt.Sprintf("%t-%s", v.Iframe, strings.Join(sampleEntries, ","))
+}
+
+// Returns the EXT-X-MEDIA groups referenced by the given variants
+func referencedGroups(variants []*m3u8.Variant) map[alternativeGroup]struct{} {
+	groups := map[alternativeGroup]struct{}{}
+	for _, v := range variants {
+		references := map[string]string{
+			"AUDIO":           v.Audio,
+			"VIDEO":           v.Video,
+			"SUBTITLES":       v.Subtitles,
+			"CLOSED-CAPTIONS": v.Captions,
+		}
+
+		for renditionType, groupID := range references {
+			if groupID == "" || groupID == "NONE" {
+				continue
 			}
+			groups[alternativeGroup{renditionType: renditionType, groupID: groupID}] = struct{}{}
 		}
+	}
 
-		filteredManifest.Append(uri, normalizedVariant.Chunklist, normalizedVariant.VariantParams)
+	return groups
+}
+
+// pruneAlternatives removes the renditions whose group was referenced by the original
+// variants but is no longer referenced by any of the filtered ones
+func pruneAlternatives(alternatives []*m3u8.Alternative, originalGroups, filteredGroups map[alternativeGroup]struct{}) []*m3u8.Alternative {
+	var prunedAlternatives []*m3u8.Alternative
+	for _, a := range alternatives {
+		group := alternativeGroup{renditionType: a.Type, groupID: a.GroupId}
+		_, wasReferenced := originalGroups[group]
+		_, isReferenced := filteredGroups[group]
+		if wasReferenced && !isReferenced {
+			continue
+		}
+
+		prunedAlternatives = append(prunedAlternatives, a)
 	}
 
-	return filteredManifest.String(), nil
+	return prunedAlternatives
+}
+
+// Returns true if specified alternative should be removed from filter. The channel count
+// is 0 when the alternative does not advertise one. The codecs are those of the rendition,
+// or those listed by each variant of its group, the rendition being removed only when
+// every one of them is filtered
+func (h *HLSFilter) validateAlternative(filters *parsers.MediaFilters, a *m3u8.Alternative, channels int, codecs [][]string) bool {
+	if isStreamTypeFiltered(filters, renditionContentTypes[a.Type]) {
+		return true
+	}
+
+	switch a.Type {
+	case "AUDIO":
+		var excluded, kept map[string]struct{}
+		if filters.Audios != nil {
+			excluded = map[string]struct{}{}
+			for _, at := range filters.Audios {
+				excluded[string(at)] = struct{}{}
+			}
+		}
+		if filters.KeepAudios != nil {
+			kept = map[string]struct{}{}
+			for _, at := range filters.KeepAudios {
+				kept[string(at)] = struct{}{}
+			}
+		}
+
+		if h.alternativeCodecsFiltered(audioContentType, codecs, excluded, kept) {
+			return true
+		}
+
+		if filters.DefinesAudioDescriptionFilter() && strings.Contains(a.Characteristics, audioDescriptionCharacteristic) {
+			return true
+		}
+
+		if filters.AudioChannels != nil && channels != 0 && !filters.AudioChannels.Includes(channels) {
+			return true
+		}
+
+		for _, lang := range filters.AudioLanguages {
+			if strings.EqualFold(a.Language, string(lang)) {
+				return true
+			}
+		}
+
+		if filters.KeepAudioLanguages != nil && a.Language != "" {
+			var kept []string
+			for _, lang := range filters.KeepAudioLanguages {
+				kept = append(kept, string(lang))
+			}
+
+			return !containsFold(kept, a.Language)
+		}
+	case "SUBTITLES", "CLOSED-CAPTIONS":
+		var excluded, kept map[string]struct{}
+		if filters.CaptionTypes != nil {
+			excluded = map[string]struct{}{}
+			for _, ct := range filters.CaptionTypes {
+				excluded[string(ct)] = struct{}{}
+			}
+		}
+		if filters.KeepCaptionTypes != nil {
+			kept = map[string]struct{}{}
+			for _, ct := range filters.KeepCaptionTypes {
+				kept[string(ct)] = struct{}{}
+			}
+		}
+
+		if h.alternativeCodecsFiltered(captionContentType, codecs, excluded, kept) {
+			return true
+		}
+
+		for _, lang := range filters.CaptionLanguages {
+			if strings.EqualFold(a.Language, string(lang)) {
+				return true
+			}
+		}
+
+		if filters.KeepCaptionLanguages != nil && a.Language != "" {
+			var kept []string
+			for _, lang := range filters.KeepCaptionLanguages {
+				kept = append(kept, string(lang))
+			}
+
+			return !containsFold(kept, a.Language)
+		}
+	}
+
+	return false
+}
+
+// Returns true if each of the codec lists of the rendition has a codec excluded or not
+// kept. Renditions without codecs are kept
+func (h *HLSFilter) alternativeCodecsFiltered(ct ContentType, codecs [][]string, excluded, kept map[string]struct{}) bool {
+	if len(codecs) == 0 || (excluded == nil && kept == nil) {
+		return false
+	}
+
+	for _, list := range codecs {
+		// the content types of renditions are always registered, so no error can be returned
+		isExcluded, _ := validateVariantCodecs(ct, list, excluded, h.codecs)
+		isNotKept, _ := validateVariantKeptCodecs(ct, list, kept, h.codecs)
+		if !isExcluded && !(kept != nil && isNotKept) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns true if the value is in the list, compared without case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true if the content type is listed in the stream type filter
+func isStreamTypeFiltered(filters *parsers.MediaFilters, ct ContentType) bool {
+	for _, streamType := range filters.FilterStreamTypes {
+		if string(streamType) == string(ct) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addAudioOnlyVariants adds an audio only variant for each AUDIO group only referenced
+// by variants carrying video, so that the group can still be played once video streams
+// are filtered. The variant points at the default rendition of the group, and takes the
+// audio codecs and the lowest bandwidth of the video variants as the bandwidth of the
+// rendition is not advertised
+func (h *HLSFilter) addAudioOnlyVariants(variants []*m3u8.Variant, alternatives []*m3u8.Alternative) []*m3u8.Variant {
+	audioOnlyGroups := map[string]struct{}{}
+	for _, v := range variants {
+		if v.Audio != "" && !v.Iframe && !h.variantHasVideo(v, strings.Split(v.Codecs, ",")) {
+			audioOnlyGroups[v.Audio] = struct{}{}
+		}
+	}
+
+	audioOnlyVariants := map[string]*m3u8.Variant{}
+	var withAudioOnly []*m3u8.Variant
+	for _, v := range variants {
+		withAudioOnly = append(withAudioOnly, v)
+		if _, found := audioOnlyGroups[v.Audio]; v.Audio == "" || v.Iframe || found {
+			continue
+		}
+
+		if audioOnly, found := audioOnlyVariants[v.Audio]; found {
+			if v.Bandwidth < audioOnly.Bandwidth {
+				audioOnly.Bandwidth = v.Bandwidth
+			}
+			continue
+		}
+
+		rendition := defaultRendition(alternatives, "AUDIO", v.Audio)
+		if rendition == nil {
+			continue
+		}
+
+		var audioCodecs []string
+		for _, codec := range strings.Split(v.Codecs, ",") {
+			if h.codecs.matchFunctions()[audioContentType](codec) {
+				audioCodecs = append(audioCodecs, codec)
+			}
+		}
+
+		audioOnly := &m3u8.Variant{
+			URI: rendition.URI,
+			VariantParams: m3u8.VariantParams{
+				Bandwidth: v.Bandwidth,
+				Codecs:    strings.Join(audioCodecs, ","),
+				Audio:     v.Audio,
+				Subtitles: v.Subtitles,
+			},
+		}
+		audioOnlyVariants[v.Audio] = audioOnly
+		withAudioOnly = append(withAudioOnly, audioOnly)
+	}
+
+	return withAudioOnly
+}
+
+// defaultRendition returns the DEFAULT=YES rendition of the group with a URI, or its
+// first one with a URI
+func defaultRendition(alternatives []*m3u8.Alternative, renditionType, groupID string) *m3u8.Alternative {
+	var rendition *m3u8.Alternative
+	for _, a := range alternatives {
+		if a.Type != renditionType || a.GroupId != groupID || a.URI == "" {
+			continue
+		}
+
+		if a.Default {
+			return a
+		}
+
+		if rendition == nil {
+			rendition = a
+		}
+	}
+
+	return rendition
+}
+
+// Removes the variant references to rendition groups of a filtered stream type, along
+// with the codecs of the streams they carried
+func (h *HLSFilter) clearFilteredStreamTypes(filters *parsers.MediaFilters, v *m3u8.Variant) {
+	if isStreamTypeFiltered(filters, audioContentType) && v.Audio != "" {
+		v.Codecs = h.removeCodecs(v.Codecs, audioContentType)
+	}
+
+	if isStreamTypeFiltered(filters, captionContentType) {
+		v.Codecs = h.removeCodecs(v.Codecs, captionContentType)
+	}
+
+	if isStreamTypeFiltered(filters, audioContentType) {
+		v.Audio = ""
+	}
+
+	if isStreamTypeFiltered(filters, videoContentType) {
+		v.Video = ""
+	}
+
+	if isStreamTypeFiltered(filters, captionContentType) {
+		v.Subtitles = ""
+		v.Captions = ""
+	}
+}
+
+// removeCodecs removes the codecs of the content type from a CODECS attribute. The codecs
+// are left as is when none would remain, so that the variant is removed as carrying only
+// filtered streams
+func (h *HLSFilter) removeCodecs(codecs string, ct ContentType) string {
+	var kept []string
+	for _, codec := range strings.Split(codecs, ",") {
+		if !h.codecs.matchFunctions()[ct](codec) {
+			kept = append(kept, codec)
+		}
+	}
+
+	if len(kept) == 0 {
+		return codecs
+	}
+
+	return strings.Join(kept, ",")
+}
+
+// Returns true if the variant depends on an audio group that no longer has any rendition
+func referencesEmptiedGroup(v *m3u8.Variant, emptiedGroups map[alternativeGroup]struct{}) bool {
+	if v.Audio == "" {
+		return false
+	}
+
+	_, emptied := emptiedGroups[alternativeGroup{renditionType: "AUDIO", groupID: v.Audio}]
+	return emptied
+}
+
+// Removes the subtitle and closed caption group references that no longer have any rendition
+func clearEmptiedGroups(v *m3u8.Variant, emptiedGroups map[alternativeGroup]struct{}) {
+	if _, emptied := emptiedGroups[alternativeGroup{renditionType: "SUBTITLES", groupID: v.Subtitles}]; emptied {
+		v.Subtitles = ""
+	}
+
+	if _, emptied := emptiedGroups[alternativeGroup{renditionType: "CLOSED-CAPTIONS", groupID: v.Captions}]; emptied {
+		v.Captions = ""
+	}
 }
 
 // Returns true if specified variant should be removed from filter
 func (h *HLSFilter) validateVariants(filters *parsers.MediaFilters, v *m3u8.Variant) (bool, error) {
-	if filters.DefinesBitrateFilter() {
-		if !(h.validateBandwidthVariant(filters.MinBitrate, filters.MaxBitrate, v)) {
+	if v.Iframe && filters.DefinesIframeFilter() {
+		return true, nil
+	}
+
+	// the range given without a track type applies to the variants carrying video, as for
+	// DASH representations, variants without codecs being taken as video ones
+	variantCodecs := strings.Split(v.Codecs, ",")
+	if filters.DefinesBitrateFilter() && !h.variantIsAudioOnly(v, variantCodecs) {
+		if !(h.validateBandwidthVariant(filters.MinBitrate, filters.MaxBitrate, variantBandwidth(filters, v))) {
 			return true, nil
 		}
 	}
 
-	variantCodecs := strings.Split(v.Codecs, ",")
+	if filters.Resolution != nil && v.Resolution != "" {
+		var width, height int
+		if _, err := fmt.Sscanf(v.Resolution, "%dx%d", &width, &height); err != nil {
+			return false, fmt.Errorf("parsing variant resolution %q: %w", v.Resolution, err)
+		}
+
+		if !filters.Resolution.Includes(width, height) {
+			return true, nil
+		}
+	}
+
+	if filters.FrameRate != nil && v.FrameRate != 0 && !filters.FrameRate.Includes(v.FrameRate) {
+		return true, nil
+	}
+
+	if filters.VideoBitrate != nil || filters.AudioBitrate != nil {
+		bandwidth := variantBandwidth(filters, v)
+		hasVideo := h.variantHasVideo(v, variantCodecs)
+		if hasVideo && filters.VideoBitrate != nil && !filters.VideoBitrate.Includes(bandwidth) {
+			return true, nil
+		}
+
+		if !hasVideo && h.variantHasAudio(variantCodecs) && filters.AudioBitrate != nil &&
+			!filters.AudioBitrate.Includes(bandwidth) {
+			return true, nil
+		}
+	}
+
+	if filters.FilterStreamTypes != nil && h.validateVariantStreamTypes(filters, v, variantCodecs) {
+		return true, nil
+	}
+
+	if filters.VideoRanges != nil && h.validateVariantVideoRange(filters, v, variantCodecs) {
+		return true, nil
+	}
+
+	if filters.VideoLevels != nil {
+		for _, codec := range variantCodecs {
+			if exceedsVideoLevel(codec, filters.VideoLevels) {
+				return true, nil
+			}
+		}
+	}
 
 	if filters.Audios != nil {
 		supportedAudioTypes := map[string]struct{}{}
 		for _, at := range filters.Audios {
 			supportedAudioTypes[string(at)] = struct{}{}
 		}
-		res, err := validateVariantCodecs(audioContentType, variantCodecs, supportedAudioTypes, matchFunctions)
+		res, err := validateVariantCodecs(audioContentType, variantCodecs, supportedAudioTypes, h.codecs)
 		if res {
 			return true, err
 		}
@@ -115,7 +913,7 @@ func (h *HLSFilter) validateVariants(filters *parsers.MediaFilters, v *m3u8.Vari
 		for _, vt := range filters.Videos {
 			supportedVideoTypes[string(vt)] = struct{}{}
 		}
-		res, err := validateVariantCodecs(videoContentType, variantCodecs, supportedVideoTypes, matchFunctions)
+		res, err := validateVariantCodecs(videoContentType, variantCodecs, supportedVideoTypes, h.codecs)
 		if res {
 			return true, err
 		}
@@ -126,7 +924,40 @@ func (h *HLSFilter) validateVariants(filters *parsers.MediaFilters, v *m3u8.Vari
 		for _, ct := range filters.CaptionTypes {
 			supportedCaptionTypes[string(ct)] = struct{}{}
 		}
-		res, err := validateVariantCodecs(captionContentType, variantCodecs, supportedCaptionTypes, matchFunctions)
+		res, err := validateVariantCodecs(captionContentType, variantCodecs, supportedCaptionTypes, h.codecs)
+		if res {
+			return true, err
+		}
+	}
+
+	if filters.KeepAudios != nil {
+		keptAudioTypes := map[string]struct{}{}
+		for _, at := range filters.KeepAudios {
+			keptAudioTypes[string(at)] = struct{}{}
+		}
+		res, err := validateVariantKeptCodecs(audioContentType, variantCodecs, keptAudioTypes, h.codecs)
+		if res {
+			return true, err
+		}
+	}
+
+	if filters.KeepVideos != nil {
+		keptVideoTypes := map[string]struct{}{}
+		for _, vt := range filters.KeepVideos {
+			keptVideoTypes[string(vt)] = struct{}{}
+		}
+		res, err := validateVariantKeptCodecs(videoContentType, variantCodecs, keptVideoTypes, h.codecs)
+		if res {
+			return true, err
+		}
+	}
+
+	if filters.KeepCaptionTypes != nil {
+		keptCaptionTypes := map[string]struct{}{}
+		for _, ct := range filters.KeepCaptionTypes {
+			keptCaptionTypes[string(ct)] = struct{}{}
+		}
+		res, err := validateVariantKeptCodecs(captionContentType, variantCodecs, keptCaptionTypes, h.codecs)
 		if res {
 			return true, err
 		}
@@ -135,11 +966,65 @@ func (h *HLSFilter) validateVariants(filters *parsers.MediaFilters, v *m3u8.Vari
 	return false, nil
 }
 
+// Returns true if the variant carries video while video streams are filtered, or if
+// every stream it carries is of a filtered type
+func (h *HLSFilter) validateVariantStreamTypes(filters *parsers.MediaFilters, v *m3u8.Variant, variantCodecs []string) bool {
+	contentTypes := map[ContentType]struct{}{}
+	if v.Resolution != "" || v.Iframe {
+		contentTypes[videoContentType] = struct{}{}
+	}
+
+	for _, codec := range variantCodecs {
+		for ct, match := range h.codecs.matchFunctions() {
+			if match(codec) {
+				contentTypes[ct] = struct{}{}
+			}
+		}
+	}
+
+	if _, hasVideo := contentTypes[videoContentType]; hasVideo && isStreamTypeFiltered(filters, videoContentType) {
+		return true
+	}
+
+	if len(contentTypes) == 0 {
+		return false
+	}
+
+	for ct := range contentTypes {
+		if !isStreamTypeFiltered(filters, ct) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns true if the variant carries video of a filtered video range. Video variants
+// without a VIDEO-RANGE attribute are SDR
+func (h *HLSFilter) validateVariantVideoRange(filters *parsers.MediaFilters, v *m3u8.Variant, variantCodecs []string) bool {
+	if !h.variantHasVideo(v, variantCodecs) {
+		return false
+	}
+
+	videoRange := parsers.VideoRange(strings.ToLower(v.VideoRange))
+	if videoRange == "" {
+		videoRange = sdrVideoRange
+	}
+
+	for _, filtered := range filters.VideoRanges {
+		if filtered == videoRange {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Returns true if the given variant (variantCodecs) should be allowed filtered out for supportedCodecs of filterType
-func validateVariantCodecs(filterType ContentType, variantCodecs []string, supportedCodecs map[string]struct{}, supportedFilterTypes map[ContentType]func(string) bool) (bool, error) {
+func validateVariantCodecs(filterType ContentType, variantCodecs []string, supportedCodecs map[string]struct{}, codecs *CodecRegistry) (bool, error) {
 	var matchFilterType func(string) bool
 
-	matchFilterType, found := supportedFilterTypes[filterType]
+	matchFilterType, found := codecs.matchFunctions()[filterType]
 
 	if !found {
 		return false, errors.New("filter type is unsupported")
@@ -149,7 +1034,7 @@ func validateVariantCodecs(filterType ContentType, variantCodecs []string, suppo
 	for _, codec := range variantCodecs {
 		if matchFilterType(codec) {
 			for sc := range supportedCodecs {
-				if ValidCodecs(codec, CodecFilterID(sc)) {
+				if codecs.Matches(codec, sc) {
 					variantFound = true
 					break
 				}
@@ -160,8 +1045,36 @@ func validateVariantCodecs(filterType ContentType, variantCodecs []string, suppo
 	return variantFound, nil
 }
 
-func (h *HLSFilter) validateBandwidthVariant(minBitrate int, maxBitrate int, v *m3u8.Variant) bool {
-	bw := int(v.VariantParams.Bandwidth)
+// Returns true if the given variant (variantCodecs) has a codec of filterType matching none of
+// the keptCodecs. Variants without a codec of filterType are kept
+func validateVariantKeptCodecs(filterType ContentType, variantCodecs []string, keptCodecs map[string]struct{}, codecs *CodecRegistry) (bool, error) {
+	matchFilterType, found := codecs.matchFunctions()[filterType]
+	if !found {
+		return false, errors.New("filter type is unsupported")
+	}
+
+	for _, codec := range variantCodecs {
+		if !matchFilterType(codec) {
+			continue
+		}
+
+		kept := false
+		for kc := range keptCodecs {
+			if codecs.Matches(codec, kc) {
+				kept = true
+				break
+			}
+		}
+
+		if !kept {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (h *HLSFilter) validateBandwidthVariant(minBitrate int, maxBitrate int, bw int) bool {
 	if bw > maxBitrate || bw < minBitrate {
 		return false
 	}
@@ -169,13 +1082,46 @@ func (h *HLSFilter) validateBandwidthVariant(minBitrate int, maxBitrate int, v *
 	return true
 }
 
-func (h *HLSFilter) normalizeVariant(v *m3u8.Variant, absolute url.URL) (*m3u8.Variant, error) {
-	for _, a := range v.VariantParams.Alternatives {
-		aURL, aErr := combinedIfRelative(a.URI, absolute)
-		if aErr != nil {
-			return v, aErr
+// Returns the bandwidth of the variant the bitrate filters apply to, which is the
+// AVERAGE-BANDWIDTH when asked for and advertised, and the peak BANDWIDTH otherwise
+func variantBandwidth(filters *parsers.MediaFilters, v *m3u8.Variant) int {
+	if filters.AverageBandwidth && v.AverageBandwidth != 0 {
+		return int(v.AverageBandwidth)
+	}
+
+	return int(v.Bandwidth)
+}
+
+// Returns true if the variant carries video, either advertised by its codecs, its
+// resolution or as an I-frame variant
+func (h *HLSFilter) variantHasVideo(v *m3u8.Variant, variantCodecs []string) bool {
+	hasVideo := v.Resolution != "" || v.Iframe
+	for _, codec := range variantCodecs {
+		hasVideo = hasVideo || h.codecs.matchFunctions()[videoContentType](codec)
+	}
+
+	return hasVideo
+}
+
+// Returns true if the variant only carries audio
+func (h *HLSFilter) variantIsAudioOnly(v *m3u8.Variant, variantCodecs []string) bool {
+	return !h.variantHasVideo(v, variantCodecs) && h.variantHasAudio(variantCodecs)
+}
+
+// Returns true if any of the variant codecs is an audio codec
+func (h *HLSFilter) variantHasAudio(variantCodecs []string) bool {
+	for _, codec := range variantCodecs {
+		if h.codecs.matchFunctions()[audioContentType](codec) {
+			return true
 		}
-		a.URI = aURL
+	}
+
+	return false
+}
+
+func (h *HLSFilter) normalizeVariant(v *m3u8.Variant, absolute url.URL) (*m3u8.Variant, error) {
+	if aErr := normalizeAlternatives(v.VariantParams.Alternatives, absolute); aErr != nil {
+		return v, aErr
 	}
 
 	vURL, vErr := combinedIfRelative(v.URI, absolute)
@@ -186,16 +1132,27 @@ func (h *HLSFilter) normalizeVariant(v *m3u8.Variant, absolute url.URL) (*m3u8.V
 	return v, nil
 }
 
+func normalizeAlternatives(alternatives []*m3u8.Alternative, absolute url.URL) error {
+	for _, a := range alternatives {
+		aURL, aErr := combinedIfRelative(a.URI, absolute)
+		if aErr != nil {
+			return aErr
+		}
+		a.URI = aURL
+	}
+
+	return nil
+}
+
 func (h *HLSFilter) normalizeTrimmedVariant(filters *parsers.MediaFilters, uri string) (string, error) {
 	encoded := base64.RawURLEncoding.EncodeToString([]byte(uri))
-	start := filters.Trim.Start
-	end := filters.Trim.End
+	trim := parsers.MediaFilters{Trim: filters.Trim}
 	u, err := url.Parse(uri)
 	if err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%v://%v/t(%v,%v)/%v.m3u8", u.Scheme, h.config.Hostname, start, end, encoded), nil
+	return fmt.Sprintf("%v://%v%v/%v.m3u8", u.Scheme, h.config.Hostname, trim.Path(), encoded), nil
 }
 
 func combinedIfRelative(uri string, absolute url.URL) (string, error) {
@@ -232,16 +1189,34 @@ func (h *HLSFilter) filterRenditionManifest(filters *parsers.MediaFilters, m *m3
 		return "", fmt.Errorf("filtering Rendition Manifest: %w", err)
 	}
 
-	for _, segment := range m.Segments {
+	// firstKept is the index of the first segment kept, or the number of segments when
+	// none is kept yet
+	var offset, liveEdge float64
+	firstKept := -1
+	var count int
+	for i, segment := range m.Segments {
 		if segment == nil {
 			continue
 		}
+		count++
 
-		if segment.ProgramDateTime == (time.Time{}) {
-			return "", fmt.Errorf("Program Date Time not set on segments")
+		// segments are placed either by their program date time or by the sum of the
+		// durations of the segments before them
+		start := offset
+		offset += segment.Duration
+		if !filters.Trim.Offset {
+			if segment.ProgramDateTime == (time.Time{}) {
+				return "", fmt.Errorf("Program Date Time not set on segments")
+			}
+			start = float64(segment.ProgramDateTime.UnixNano()) / float64(time.Second)
 		}
+		liveEdge = start + segment.Duration
+
+		if inTrim(filters.Trim, start, start+segment.Duration) {
+			if firstKept < 0 {
+				firstKept = i
+			}
 
-		if inRange(filters.Trim.Start, filters.Trim.End, segment.ProgramDateTime.Unix()) {
 			absolute, err := getAbsoluteURL(h.manifestURL)
 			if err != nil {
 				return "", fmt.Errorf("formatting segment URLs: %w", err)
@@ -259,16 +1234,25 @@ func (h *HLSFilter) filterRenditionManifest(filters *parsers.MediaFilters, m *m3
 		}
 	}
 
-	filteredPlaylist.Close()
+	// the media sequence follows the segments of the origin dropped before the first one
+	// kept, so that it never goes back as the playlist is reloaded, and the playlist keeps
+	// the type of its origin, as only an event origin never removes segments
+	if firstKept < 0 {
+		firstKept = count
+	}
+	filteredPlaylist.SeqNo = m.SeqNo + uint64(firstKept)
+	filteredPlaylist.MediaType = m.MediaType
 
-	return filteredPlaylist.Encode().String(), nil
-}
+	// a trim ending after the last segment of a live playlist is still being recorded,
+	// so the playlist is left open for players to keep polling it until the end passes
+	if m.Closed || float64(filters.Trim.End) <= liveEdge {
+		filteredPlaylist.Close()
+	}
 
-func inRange(start int64, end int64, value int64) bool {
-	return (start <= value) && (value <= end)
+	return filteredPlaylist.Encode().String(), nil
 }
 
-//Returns absolute url of given manifest as a string
+// Returns absolute url of given manifest as a string
 func getAbsoluteURL(path string) (*url.URL, error) {
 	absoluteURL, _ := filepath.Split(path)
 	return url.Parse(absoluteURL)
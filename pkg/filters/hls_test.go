@@ -2,6 +2,7 @@ package filters
 
 import (
 	"math"
+	"strings"
 	"testing"
 
 	"github.com/cbsinteractive/bakery/pkg/config"
@@ -28,7 +29,8 @@ http://existing.base/uri/link_1.m3u8
 `
 
 	manifestRemovedHigherBW := `#EXTM3U
-#EXT-X-VERSION:3
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="CC",NAME="ENGLISH",DEFAULT=NO,LANGUAGE="ENG"
 #EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CLOSED-CAPTIONS="CC"
 http://existing.base/uri/link_2.m3u8
 `
@@ -793,6 +795,8 @@ http://existing.base/uri/link_13.m3u8
 
 	manifestFilter4000To6000BandwidthAndAC3 := `#EXTM3U
 #EXT-X-VERSION:3
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="ac-3"
+http://existing.base/uri/link_1.m3u8
 #EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4200,AVERAGE-BANDWIDTH=4200,CODECS="avc1.77.30"
 http://existing.base/uri/link_2.m3u8
 #EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="ac-3,hvc1.2.4.L93.90"
@@ -805,6 +809,8 @@ http://existing.base/uri/link_13.m3u8
 
 	manifestFilter4000To6000BandwidthAndDVH := `#EXTM3U
 #EXT-X-VERSION:3
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="ac-3"
+http://existing.base/uri/link_1.m3u8
 #EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=5900,AVERAGE-BANDWIDTH=5900,CODECS="ac-3,ec-3"
 http://existing.base/uri/link_7b.m3u8
 #EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=5300,AVERAGE-BANDWIDTH=5300
@@ -823,6 +829,8 @@ http://existing.base/uri/link_13.m3u8
 
 	manifestFilter4000To6000BandwidthAndWVTT := `#EXTM3U
 #EXT-X-VERSION:3
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="ac-3"
+http://existing.base/uri/link_1.m3u8
 #EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4200,AVERAGE-BANDWIDTH=4200,CODECS="avc1.77.30"
 http://existing.base/uri/link_2.m3u8
 #EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="ac-3,hvc1.2.4.L93.90"
@@ -861,13 +869,13 @@ http://existing.base/uri/link_13.m3u8
 			expectManifestContent: manifestWithAllCodecsAndBandwidths,
 		},
 		{
-			name:                  "when filtering out audio (ec-3) in bandwidth range 4000-6000, expect variants with ec-3, mp4a, and/or not in range to be stripped out",
+			name:                  "when filtering out audio (ec-3) in bandwidth range 4000-6000, expect variants with ec-3, mp4a, and/or not in range to be stripped out, audio only variants being kept out of the range",
 			filters:               &parsers.MediaFilters{Audios: []parsers.AudioType{"ec-3"}, MinBitrate: 4000, MaxBitrate: 6000},
 			manifestContent:       manifestWithAllCodecsAndBandwidths,
 			expectManifestContent: manifestFilter4000To6000BandwidthAndAC3,
 		},
 		{
-			name:                  "when filtering out video (avc and hevc) in bandwidth range 4000-6000, expect variants with avc, hevc, and/or not in range to be stripped out",
+			name:                  "when filtering out video (avc and hevc) in bandwidth range 4000-6000, expect variants with avc, hevc, and/or not in range to be stripped out, audio only variants being kept out of the range",
 			filters:               &parsers.MediaFilters{Videos: []parsers.VideoType{"avc", "hvc"}, MinBitrate: 4000, MaxBitrate: 6000},
 			manifestContent:       manifestWithAllCodecsAndBandwidths,
 			expectManifestContent: manifestFilter4000To6000BandwidthAndDVH,
@@ -879,7 +887,7 @@ http://existing.base/uri/link_13.m3u8
 			expectManifestContent: manifestFilter4000To6000BandwidthAndEC3AndAVC,
 		},
 		{
-			name:                  "when filtering out captions (stpp) in bandwidth range 4000-6000, expect variants with stpp and/or not in range to be stripped out",
+			name:                  "when filtering out captions (stpp) in bandwidth range 4000-6000, expect variants with stpp and/or not in range to be stripped out, audio only variants being kept out of the range",
 			filters:               &parsers.MediaFilters{CaptionTypes: []parsers.CaptionType{"stpp"}, MinBitrate: 4000, MaxBitrate: 6000},
 			manifestContent:       manifestWithAllCodecsAndBandwidths,
 			expectManifestContent: manifestFilter4000To6000BandwidthAndWVTT,
@@ -1152,7 +1160,8 @@ https://bakery.cbsi.video/t(10000,100000)/aHR0cHM6Ly9leGlzdGluZy5iYXNlL3BhdGgvbG
 `
 
 	manifestWithFilteredBitrateAndBase64EncodedVariantURLS := `#EXTM3U
-#EXT-X-VERSION:3
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="CC",NAME="ENGLISH",DEFAULT=NO,LANGUAGE="ENG"
 #EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4200,AVERAGE-BANDWIDTH=4200,CODECS="avc1.64001f,mp4a.40.2"
 https://bakery.cbsi.video/t(10000,100000)/aHR0cHM6Ly9leGlzdGluZy5iYXNlL3BhdGgvbGlua18yLm0zdTg.m3u8
 #EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,mp4a.40.2"
@@ -1329,8 +1338,111 @@ https://existing.base/path/chan_1/chan_1_20200311T202824_1_00028.ts
 
 	variantManifestTrimmed := `#EXTM3U
 #EXT-X-VERSION:3
-#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-MEDIA-SEQUENCE:12
+#EXT-X-TARGETDURATION:6
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:00Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202754_1_00021.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:06Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202801_1_00022.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:12Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202806_1_00023.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:18Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202813_1_00024.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:24Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202818_1_00025.ts
+#EXT-X-ENDLIST
+`
+
+	variantManifestTrimmedByOffset := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:12
+#EXT-X-TARGETDURATION:6
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202754_1_00021.ts
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202801_1_00022.ts
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202806_1_00023.ts
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202813_1_00024.ts
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202818_1_00025.ts
+#EXT-X-ENDLIST
+`
+
+	variantManifestTrimmedByOffsetWithOverlap := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:12
+#EXT-X-TARGETDURATION:6
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202754_1_00021.ts
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202801_1_00022.ts
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202806_1_00023.ts
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202813_1_00024.ts
+#EXT-X-ENDLIST
+`
+
+	variantManifestTrimmedByOffsetInside := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:13
+#EXT-X-TARGETDURATION:6
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202801_1_00022.ts
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202806_1_00023.ts
+#EXT-X-ENDLIST
+`
+
+	variantManifestTrimmedAsEvent := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-PLAYLIST-TYPE:EVENT
+#EXT-X-ALLOW-CACHE:NO
+#EXT-X-MEDIA-SEQUENCE:17
+#EXT-X-TARGETDURATION:6
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:30Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202824_1_00026.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:36Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202818_1_00027.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:42Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202824_1_00028.ts
+`
+
+	variantManifestTrimmedOpen := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:17
+#EXT-X-TARGETDURATION:6
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:30Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202824_1_00026.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:36Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202818_1_00027.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:42Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202824_1_00028.ts
+`
+
+	variantManifestTrimmedFromSlidWindow := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:10
 #EXT-X-TARGETDURATION:6
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:51:48Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202743_1_00019.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:51:54Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202748_1_00020.ts
 #EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:00Z
 #EXTINF:6.000,
 https://existing.base/path/chan_1/chan_1_20200311T202754_1_00021.ts
@@ -1346,9 +1458,43 @@ https://existing.base/path/chan_1/chan_1_20200311T202813_1_00024.ts
 #EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:24Z
 #EXTINF:6.000,
 https://existing.base/path/chan_1/chan_1_20200311T202818_1_00025.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:30Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202824_1_00026.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:36Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202818_1_00027.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:42Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202824_1_00028.ts
+`
+
+	variantManifestTrimmedAfterEnd := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:17
+#EXT-X-TARGETDURATION:6
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:30Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202824_1_00026.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:36Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202818_1_00027.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-03-11T00:52:42Z
+#EXTINF:6.000,
+https://existing.base/path/chan_1/chan_1_20200311T202824_1_00028.ts
 #EXT-X-ENDLIST
 `
 
+	trimAfterLiveEdge := &parsers.Trim{
+		Start: 1583887950, //2020-03-11T00:52:30
+		End:   1583888000, //2020-03-11T00:53:20
+	}
+
+	trimBeforeWindow := &parsers.Trim{
+		Start: 1583887900, //2020-03-11T00:51:40
+		End:   1583888000, //2020-03-11T00:53:20
+	}
+
 	trim := &parsers.Trim{
 		Start: 1583887920, //2020-03-11T00:52:00
 		End:   1583887944, //2020-03-11T00:52:24
@@ -1381,6 +1527,71 @@ https://existing.base/path/chan_1/chan_1_20200311T202818_1_00025.ts
 			expectManifestContent: "",
 			expectErr:             true,
 		},
+		{
+			name:                  "when trimming by offset, segments starting within the trim are kept without pdt",
+			filters:               &parsers.MediaFilters{Trim: &parsers.Trim{Start: 12, End: 36, Offset: true}},
+			manifestContent:       variantManifestWithNoPDT,
+			expectManifestContent: variantManifestTrimmedByOffset,
+		},
+		{
+			name: "when trimming by offset with overlapping boundaries, segments partly in the trim are kept",
+			filters: &parsers.MediaFilters{
+				Trim: &parsers.Trim{Start: 14, End: 34, Offset: true, Boundary: parsers.TrimOverlap},
+			},
+			manifestContent:       variantManifestWithNoPDT,
+			expectManifestContent: variantManifestTrimmedByOffsetWithOverlap,
+		},
+		{
+			name: "when trimming by offset inside boundaries, only segments entirely in the trim are kept",
+			filters: &parsers.MediaFilters{
+				Trim: &parsers.Trim{Start: 14, End: 34, Offset: true, Boundary: parsers.TrimInside},
+			},
+			manifestContent:       variantManifestWithNoPDT,
+			expectManifestContent: variantManifestTrimmedByOffsetInside,
+		},
+		{
+			name:    "when the trim ends after the last segment of an event playlist, an event playlist is returned",
+			filters: &parsers.MediaFilters{Trim: trimAfterLiveEdge},
+			manifestContent: strings.Replace(variantManifestWithAbsoluteURLs, "#EXT-X-VERSION:3\n",
+				"#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:EVENT\n", 1),
+			expectManifestContent: variantManifestTrimmedAsEvent,
+		},
+		{
+			name: "when an event playlist ends before the end of the trim, the playlist is closed as an event " +
+				"playlist with the same media sequence",
+			filters: &parsers.MediaFilters{Trim: trimAfterLiveEdge},
+			manifestContent: strings.Replace(variantManifestWithAbsoluteURLs, "#EXT-X-VERSION:3\n",
+				"#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:EVENT\n", 1) + "#EXT-X-ENDLIST\n",
+			expectManifestContent: variantManifestTrimmedAsEvent + "#EXT-X-ENDLIST\n",
+		},
+		{
+			name: "when the trim ends after the last segment of a sliding window playlist, the playlist is " +
+				"left open without a playlist type",
+			filters:               &parsers.MediaFilters{Trim: trimAfterLiveEdge},
+			manifestContent:       variantManifestWithAbsoluteURLs,
+			expectManifestContent: variantManifestTrimmedOpen,
+		},
+		{
+			name: "when the trim starts before the window of a sliding window playlist, the playlist is left " +
+				"open without a playlist type",
+			filters:               &parsers.MediaFilters{Trim: trimBeforeWindow},
+			manifestContent:       variantManifestWithAbsoluteURLs,
+			expectManifestContent: variantManifestTrimmedFromSlidWindow,
+		},
+		{
+			name:                  "when the trim ends after the last segment of a finished playlist, the playlist is closed",
+			filters:               &parsers.MediaFilters{Trim: trimAfterLiveEdge},
+			manifestContent:       variantManifestWithAbsoluteURLs + "#EXT-X-ENDLIST\n",
+			expectManifestContent: variantManifestTrimmedAfterEnd,
+		},
+		{
+			name: "when trimming by offset a playlist with pdt, the pdt is ignored",
+			filters: &parsers.MediaFilters{
+				Trim: &parsers.Trim{Start: 12, End: 36, Offset: true},
+			},
+			manifestContent:       variantManifestWithAbsoluteURLs,
+			expectManifestContent: variantManifestTrimmed,
+		},
 	}
 
 	for _, tt := range tests {
@@ -1405,3 +1616,1672 @@ https://existing.base/path/chan_1/chan_1_20200311T202818_1_00025.ts
 		})
 	}
 }
+
+func TestHLSFilter_FilterManifest_AudioLanguageFilter(t *testing.T) {
+	manifestWithAllAudioLanguages := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Portuguese",DEFAULT=NO,LANGUAGE="pt-BR",URI="http://existing.base/uri/aac_pt.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ac3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/ac3_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="avc1.64001f,ac-3",AUDIO="ac3"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithoutEnglish := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Portuguese",DEFAULT=NO,LANGUAGE="pt-BR",URI="http://existing.base/uri/aac_pt.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+`
+
+	manifestWithoutPortuguese := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ac3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/ac3_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="avc1.64001f,ac-3",AUDIO="ac3"
+http://existing.base/uri/link_2.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when no audio language filter is given, expect unfiltered manifest",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithAllAudioLanguages,
+			expectManifestContent: manifestWithAllAudioLanguages,
+		},
+		{
+			name:                  "when filtering a language that is not in the manifest, expect unfiltered manifest",
+			filters:               &parsers.MediaFilters{AudioLanguages: []parsers.AudioLanguage{"es-MX"}},
+			manifestContent:       manifestWithAllAudioLanguages,
+			expectManifestContent: manifestWithAllAudioLanguages,
+		},
+		{
+			name:                  "when filtering a language, expect matching renditions removed regardless of case",
+			filters:               &parsers.MediaFilters{AudioLanguages: []parsers.AudioLanguage{"pt-br"}},
+			manifestContent:       manifestWithAllAudioLanguages,
+			expectManifestContent: manifestWithoutPortuguese,
+		},
+		{
+			name:                  "when filtering every rendition of an audio group, expect variants using that group removed",
+			filters:               &parsers.MediaFilters{AudioLanguages: []parsers.AudioLanguage{"en"}},
+			manifestContent:       manifestWithAllAudioLanguages,
+			expectManifestContent: manifestWithoutEnglish,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_CaptionLanguageFilter(t *testing.T) {
+	manifestWithAllCaptionLanguages := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Spanish",DEFAULT=NO,LANGUAGE="es-MX",URI="http://existing.base/uri/subs_es.m3u8"
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="English",DEFAULT=NO,LANGUAGE="en"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",CLOSED-CAPTIONS="cc",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="avc1.64001f,mp4a.40.2",CLOSED-CAPTIONS="cc",SUBTITLES="subs"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithoutEnglish := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Spanish",DEFAULT=NO,LANGUAGE="es-MX",URI="http://existing.base/uri/subs_es.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="avc1.64001f,mp4a.40.2",SUBTITLES="subs"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithoutCaptions := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/link_2.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when no caption language filter is given, expect unfiltered manifest",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithAllCaptionLanguages,
+			expectManifestContent: manifestWithAllCaptionLanguages,
+		},
+		{
+			name:                  "when filtering a language, expect subtitles and closed captions in that language removed",
+			filters:               &parsers.MediaFilters{CaptionLanguages: []parsers.CaptionLanguage{"EN"}},
+			manifestContent:       manifestWithAllCaptionLanguages,
+			expectManifestContent: manifestWithoutEnglish,
+		},
+		{
+			name:                  "when filtering every caption language, expect variants to no longer reference caption groups",
+			filters:               &parsers.MediaFilters{CaptionLanguages: []parsers.CaptionLanguage{"en", "es-MX"}},
+			manifestContent:       manifestWithAllCaptionLanguages,
+			expectManifestContent: manifestWithoutCaptions,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_AlternativeRenditions(t *testing.T) {
+	manifestWithAlternatives := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,ec-3",AUDIO="ec3",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=6000,AVERAGE-BANDWIDTH=6000,CODECS="hvc1.2.4.L153.B0,ec-3",AUDIO="ec3"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithoutEC3 := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithoutAVC := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=6000,AVERAGE-BANDWIDTH=6000,CODECS="hvc1.2.4.L153.B0,ec-3",AUDIO="ec3"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithoutLowBitrate := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,ec-3",AUDIO="ec3",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=6000,AVERAGE-BANDWIDTH=6000,CODECS="hvc1.2.4.L153.B0,ec-3",AUDIO="ec3"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithRenditionCodecs := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8",CODECS="mp4a.40.2"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="English (Dolby)",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8",CODECS="ec-3"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8",CODECS="wvtt"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English (IMSC)",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/subs_en_imsc.m3u8",CODECS="stpp.ttml.im1t"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f",AUDIO="audio",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+`
+
+	manifestWithoutEC3Rendition := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8",CODECS="mp4a.40.2"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8",CODECS="wvtt"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English (IMSC)",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/subs_en_imsc.m3u8",CODECS="stpp.ttml.im1t"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f",AUDIO="audio",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+`
+
+	manifestWithWebVTTRenditionOnly := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8",CODECS="mp4a.40.2"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="English (Dolby)",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8",CODECS="ec-3"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8",CODECS="wvtt"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f",AUDIO="audio",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+`
+
+	manifestWithSharedEC3Group := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,ec-3",AUDIO="ec3"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=6000,AVERAGE-BANDWIDTH=6000,CODECS="hvc1.2.4.L153.B0",AUDIO="ec3"
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithoutSharedEC3Group := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_3.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when no filter is given, expect every rendition to be kept",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithAlternatives,
+			expectManifestContent: manifestWithAlternatives,
+		},
+		{
+			name:                  "when an audio codec is filtered, expect the renditions of its group removed along with the variants",
+			filters:               &parsers.MediaFilters{Audios: []parsers.AudioType{"ec-3"}},
+			manifestContent:       manifestWithAlternatives,
+			expectManifestContent: manifestWithoutEC3,
+		},
+		{
+			name:                  "when a video codec is filtered, expect groups no longer referenced by any variant removed",
+			filters:               &parsers.MediaFilters{Videos: []parsers.VideoType{"avc"}},
+			manifestContent:       manifestWithAlternatives,
+			expectManifestContent: manifestWithoutAVC,
+		},
+		{
+			name:                  "when an audio codec is filtered, expect the renditions advertising it removed",
+			filters:               &parsers.MediaFilters{Audios: []parsers.AudioType{"ec-3"}},
+			manifestContent:       manifestWithRenditionCodecs,
+			expectManifestContent: manifestWithoutEC3Rendition,
+		},
+		{
+			name:                  "when a caption type to keep is given, expect the renditions advertising other ones removed",
+			filters:               &parsers.MediaFilters{KeepCaptionTypes: []parsers.CaptionType{"wvtt"}},
+			manifestContent:       manifestWithRenditionCodecs,
+			expectManifestContent: manifestWithWebVTTRenditionOnly,
+		},
+		{
+			name:                  "when an audio codec is filtered, expect its group removed along with the variants without audio codecs",
+			filters:               &parsers.MediaFilters{Audios: []parsers.AudioType{"ec-3"}},
+			manifestContent:       manifestWithSharedEC3Group,
+			expectManifestContent: manifestWithoutSharedEC3Group,
+		},
+		{
+			name:                  "when the variant carrying a group is removed, expect the group kept for the remaining variants",
+			filters:               &parsers.MediaFilters{MinBitrate: 2000, MaxBitrate: 10000},
+			manifestContent:       manifestWithAlternatives,
+			expectManifestContent: manifestWithoutLowBitrate,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_StreamTypeFilter(t *testing.T) {
+	manifestWithAllStreamTypes := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8"
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="English",DEFAULT=NO,LANGUAGE="en"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aac",CLOSED-CAPTIONS="cc",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=128,AVERAGE-BANDWIDTH=128,CODECS="mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithoutText := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=128,AVERAGE-BANDWIDTH=128,CODECS="mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithoutAudio := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8"
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="English",DEFAULT=NO,LANGUAGE="en"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f",RESOLUTION=1920x1080,CLOSED-CAPTIONS="cc",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+`
+
+	manifestAudioOnly := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=128,AVERAGE-BANDWIDTH=128,CODECS="mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithoutAudioOnlyVariants := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Spanish",DEFAULT=NO,LANGUAGE="es",URI="http://existing.base/uri/aac_es.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=1280x720,AUDIO="aac"
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4500,AVERAGE-BANDWIDTH=4500,CODECS="avc1.64001f,ec-3",RESOLUTION=1920x1080,AUDIO="ec3"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithAudioOnlyVariantsAdded := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Spanish",DEFAULT=NO,LANGUAGE="es",URI="http://existing.base/uri/aac_es.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=NO,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,CODECS="mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/aac_en.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4500,CODECS="ec-3",AUDIO="ec3"
+http://existing.base/uri/ec3_en.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when no stream type filter is given, expect unfiltered manifest",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithAllStreamTypes,
+			expectManifestContent: manifestWithAllStreamTypes,
+		},
+		{
+			name:                  "when text streams are filtered, expect subtitles and closed captions removed",
+			filters:               &parsers.MediaFilters{FilterStreamTypes: []parsers.StreamType{"text"}},
+			manifestContent:       manifestWithAllStreamTypes,
+			expectManifestContent: manifestWithoutText,
+		},
+		{
+			name:                  "when audio streams are filtered, expect audio renditions and audio only variants removed",
+			filters:               &parsers.MediaFilters{FilterStreamTypes: []parsers.StreamType{"audio"}},
+			manifestContent:       manifestWithAllStreamTypes,
+			expectManifestContent: manifestWithoutAudio,
+		},
+		{
+			name:                  "when video streams are filtered, expect an audio only manifest",
+			filters:               &parsers.MediaFilters{FilterStreamTypes: []parsers.StreamType{"video"}},
+			manifestContent:       manifestWithAllStreamTypes,
+			expectManifestContent: manifestAudioOnly,
+		},
+		{
+			name:                  "when video streams are filtered, expect audio only variants added for the audio groups",
+			filters:               &parsers.MediaFilters{FilterStreamTypes: []parsers.StreamType{"video"}},
+			manifestContent:       manifestWithoutAudioOnlyVariants,
+			expectManifestContent: manifestWithAudioOnlyVariantsAdded,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_AudioDescriptionFilter(t *testing.T) {
+	manifestWithAudioDescription := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,AUTOSELECT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English (Described)",DEFAULT=NO,AUTOSELECT=YES,LANGUAGE="en",CHARACTERISTICS="public.accessibility.describes-video",URI="http://existing.base/uri/aac_en_ad.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+`
+
+	manifestWithoutAudioDescription := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,AUTOSELECT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when no audio description filter is given, expect unfiltered manifest",
+			filters:               &parsers.MediaFilters{Audios: []parsers.AudioType{"ac-3"}},
+			manifestContent:       manifestWithAudioDescription,
+			expectManifestContent: manifestWithAudioDescription,
+		},
+		{
+			name:                  "when audio description filter is given, expect described video renditions removed",
+			filters:               &parsers.MediaFilters{Audios: []parsers.AudioType{"noAd"}},
+			manifestContent:       manifestWithAudioDescription,
+			expectManifestContent: manifestWithoutAudioDescription,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_PreserveMasterTags(t *testing.T) {
+	manifestWithSessionTags := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-SESSION-KEY:METHOD=SAMPLE-AES,URI="skd://key-id",KEYFORMAT="com.apple.streamingkeydelivery",KEYFORMATVERSIONS="1"
+#EXT-X-SESSION-DATA:DATA-ID="com.example.title",VALUE="Star Trek"
+#EXT-X-SESSION-DATA:DATA-ID="com.example.lyrics",URI="lyrics.json"
+#EXT-X-START:TIME-OFFSET=10.0
+#EXT-X-CUSTOM-TAG:ID="bakery"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="ec3_en.m3u8",CHANNELS="6"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,ec-3",AUDIO="ec3"
+link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,ec-3",AUDIO="ec3"
+link_2.m3u8
+`
+
+	manifestWithAbsoluteSessionTags := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-SESSION-KEY:METHOD=SAMPLE-AES,URI="skd://key-id",KEYFORMAT="com.apple.streamingkeydelivery",KEYFORMATVERSIONS="1"
+#EXT-X-SESSION-DATA:DATA-ID="com.example.title",VALUE="Star Trek"
+#EXT-X-SESSION-DATA:DATA-ID="com.example.lyrics",URI="http://existing.base/uri/lyrics.json"
+#EXT-X-START:TIME-OFFSET=10.0
+#EXT-X-CUSTOM-TAG:ID="bakery"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8",CHANNELS="6"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,ec-3",AUDIO="ec3"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,ec-3",AUDIO="ec3"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithSessionTagsFiltered := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-SESSION-KEY:METHOD=SAMPLE-AES,URI="skd://key-id",KEYFORMAT="com.apple.streamingkeydelivery",KEYFORMATVERSIONS="1"
+#EXT-X-SESSION-DATA:DATA-ID="com.example.title",VALUE="Star Trek"
+#EXT-X-SESSION-DATA:DATA-ID="com.example.lyrics",URI="http://existing.base/uri/lyrics.json"
+#EXT-X-START:TIME-OFFSET=10.0
+#EXT-X-CUSTOM-TAG:ID="bakery"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8",CHANNELS="6"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,ec-3",AUDIO="ec3"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithoutVariants := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-SESSION-KEY:METHOD=SAMPLE-AES,URI="skd://key-id",KEYFORMAT="com.apple.streamingkeydelivery",KEYFORMATVERSIONS="1"
+#EXT-X-SESSION-DATA:DATA-ID="com.example.title",VALUE="Star Trek"
+#EXT-X-SESSION-DATA:DATA-ID="com.example.lyrics",URI="http://existing.base/uri/lyrics.json"
+#EXT-X-START:TIME-OFFSET=10.0
+#EXT-X-CUSTOM-TAG:ID="bakery"
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when no filter is given, expect every master playlist tag to be kept",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithSessionTags,
+			expectManifestContent: manifestWithAbsoluteSessionTags,
+		},
+		{
+			name:                  "when variants are filtered, expect master playlist tags to be kept",
+			filters:               &parsers.MediaFilters{MinBitrate: 2000, MaxBitrate: 5000},
+			manifestContent:       manifestWithSessionTags,
+			expectManifestContent: manifestWithSessionTagsFiltered,
+		},
+		{
+			name:                  "when every variant is filtered, expect master playlist tags to be kept",
+			filters:               &parsers.MediaFilters{Audios: []parsers.AudioType{"ec-3"}},
+			manifestContent:       manifestWithSessionTags,
+			expectManifestContent: manifestWithoutVariants,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("http://existing.base/uri/master.m3u8", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_IframeFilter(t *testing.T) {
+	manifestWithIframes := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=640x360,AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="hvc1.2.4.L93.90,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aac"
+http://existing.base/uri/link_2.m3u8
+#EXT-X-I-FRAME-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=100,CODECS="avc1.64001f",RESOLUTION=640x360,URI="http://existing.base/uri/iframe_1.m3u8"
+#EXT-X-I-FRAME-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=400,CODECS="hvc1.2.4.L93.90",RESOLUTION=1920x1080,URI="http://existing.base/uri/iframe_2.m3u8"
+`
+
+	manifestWithoutIframes := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=640x360,AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="hvc1.2.4.L93.90,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aac"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithoutHEVC := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=640x360,AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-I-FRAME-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=100,CODECS="avc1.64001f",RESOLUTION=640x360,URI="http://existing.base/uri/iframe_1.m3u8"
+`
+
+	manifestWithHigherBitrates := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=640x360,AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="hvc1.2.4.L93.90,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aac"
+http://existing.base/uri/link_2.m3u8
+#EXT-X-I-FRAME-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=400,CODECS="hvc1.2.4.L93.90",RESOLUTION=1920x1080,URI="http://existing.base/uri/iframe_2.m3u8"
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when no filter is given, expect I-frame streams to be kept",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithIframes,
+			expectManifestContent: manifestWithIframes,
+		},
+		{
+			name:                  "when iframe streams are filtered, expect every I-frame stream removed",
+			filters:               &parsers.MediaFilters{FilterStreamTypes: []parsers.StreamType{"iframe"}},
+			manifestContent:       manifestWithIframes,
+			expectManifestContent: manifestWithoutIframes,
+		},
+		{
+			name:                  "when a video codec is filtered, expect I-frame streams of that codec removed",
+			filters:               &parsers.MediaFilters{Videos: []parsers.VideoType{"hvc"}},
+			manifestContent:       manifestWithIframes,
+			expectManifestContent: manifestWithoutHEVC,
+		},
+		{
+			name:                  "when a bitrate range is given, expect I-frame streams out of range removed",
+			filters:               &parsers.MediaFilters{MinBitrate: 150, MaxBitrate: 5000},
+			manifestContent:       manifestWithIframes,
+			expectManifestContent: manifestWithHigherBitrates,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_ResolutionAndFrameRateFilter(t *testing.T) {
+	manifestWithLadder := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=640x360,AUDIO="aac",FRAME-RATE=29.970
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aac",FRAME-RATE=59.940
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=12000,AVERAGE-BANDWIDTH=12000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=3840x2160,AUDIO="aac",FRAME-RATE=59.940
+http://existing.base/uri/link_3.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=128,AVERAGE-BANDWIDTH=128,CODECS="mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_4.m3u8
+`
+
+	manifestUpTo1080p := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=640x360,AUDIO="aac",FRAME-RATE=29.970
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aac",FRAME-RATE=59.940
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=128,AVERAGE-BANDWIDTH=128,CODECS="mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_4.m3u8
+`
+
+	manifestFrom1080p := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aac",FRAME-RATE=59.940
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=12000,AVERAGE-BANDWIDTH=12000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=3840x2160,AUDIO="aac",FRAME-RATE=59.940
+http://existing.base/uri/link_3.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=128,AVERAGE-BANDWIDTH=128,CODECS="mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_4.m3u8
+`
+
+	manifestUpTo30fps := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=640x360,AUDIO="aac",FRAME-RATE=29.970
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=128,AVERAGE-BANDWIDTH=128,CODECS="mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_4.m3u8
+`
+
+	manifestWithInvalidResolution := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f",RESOLUTION=wide
+http://existing.base/uri/link_1.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when no resolution or frame rate filter is given, expect unfiltered manifest",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestWithLadder,
+		},
+		{
+			name: "when a maximum resolution is given, expect variants above it removed and audio only " +
+				"variants kept",
+			filters: &parsers.MediaFilters{Resolution: &parsers.ResolutionRange{
+				Max: parsers.Resolution{Width: 1920, Height: 1080},
+			}},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestUpTo1080p,
+		},
+		{
+			name: "when a minimum resolution is given, expect variants below it removed",
+			filters: &parsers.MediaFilters{Resolution: &parsers.ResolutionRange{
+				Min: parsers.Resolution{Width: 1920, Height: 1080},
+				Max: parsers.Resolution{Width: math.MaxInt32, Height: math.MaxInt32},
+			}},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestFrom1080p,
+		},
+		{
+			name:                  "when a maximum frame rate is given, expect variants above it removed",
+			filters:               &parsers.MediaFilters{FrameRate: &parsers.FrameRateRange{Max: 30}},
+			manifestContent:       manifestWithLadder,
+			expectManifestContent: manifestUpTo30fps,
+		},
+		{
+			name: "when a variant resolution can't be parsed, expect an error",
+			filters: &parsers.MediaFilters{Resolution: &parsers.ResolutionRange{
+				Max: parsers.Resolution{Width: 1920, Height: 1080},
+			}},
+			manifestContent: manifestWithInvalidResolution,
+			expectErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_VideoRangeFilter(t *testing.T) {
+	manifestWithVideoRanges := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="hvc1.2.4.L153.90,mp4a.40.2",RESOLUTION=3840x2160,AUDIO="aac",VIDEO-RANGE=PQ
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="hvc1.2.4.L153.90,mp4a.40.2",RESOLUTION=3840x2160,AUDIO="aac",VIDEO-RANGE=HLG
+http://existing.base/uri/link_3.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=128,AVERAGE-BANDWIDTH=128,CODECS="mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_4.m3u8
+`
+
+	manifestWithoutSDR := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="hvc1.2.4.L153.90,mp4a.40.2",RESOLUTION=3840x2160,AUDIO="aac",VIDEO-RANGE=PQ
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="hvc1.2.4.L153.90,mp4a.40.2",RESOLUTION=3840x2160,AUDIO="aac",VIDEO-RANGE=HLG
+http://existing.base/uri/link_3.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=128,AVERAGE-BANDWIDTH=128,CODECS="mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_4.m3u8
+`
+
+	manifestWithoutHDR := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=128,AVERAGE-BANDWIDTH=128,CODECS="mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_4.m3u8
+`
+
+	manifestWithoutHLG := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="hvc1.2.4.L153.90,mp4a.40.2",RESOLUTION=3840x2160,AUDIO="aac",VIDEO-RANGE=PQ
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=128,AVERAGE-BANDWIDTH=128,CODECS="mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_4.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when no video range filter is given, expect unfiltered manifest",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithVideoRanges,
+			expectManifestContent: manifestWithVideoRanges,
+		},
+		{
+			name: "when sdr is filtered, expect video variants without a video range removed and audio only " +
+				"variants kept",
+			filters:               &parsers.MediaFilters{VideoRanges: []parsers.VideoRange{"sdr"}},
+			manifestContent:       manifestWithVideoRanges,
+			expectManifestContent: manifestWithoutSDR,
+		},
+		{
+			name:                  "when pq and hlg are filtered, expect every HDR variant removed",
+			filters:               &parsers.MediaFilters{VideoRanges: []parsers.VideoRange{"pq", "hlg"}},
+			manifestContent:       manifestWithVideoRanges,
+			expectManifestContent: manifestWithoutHDR,
+		},
+		{
+			name:                  "when hlg is filtered, expect pq variants kept",
+			filters:               &parsers.MediaFilters{VideoRanges: []parsers.VideoRange{"hlg"}},
+			manifestContent:       manifestWithVideoRanges,
+			expectManifestContent: manifestWithoutHLG,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_AudioChannelsFilter(t *testing.T) {
+	manifestWithChannels := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8",CHANNELS="2"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8",CHANNELS="6"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="atmos",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/atmos_en.m3u8",CHANNELS="16/JOC"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1500,AVERAGE-BANDWIDTH=1500,CODECS="avc1.64001f,ec-3",AUDIO="ec3"
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="avc1.64001f,ec-3",AUDIO="atmos"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithStereoOnly := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8",CHANNELS="2"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+`
+
+	manifestWithSurroundOnly := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8",CHANNELS="6"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="atmos",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/atmos_en.m3u8",CHANNELS="16/JOC"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1500,AVERAGE-BANDWIDTH=1500,CODECS="avc1.64001f,ec-3",AUDIO="ec3"
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="avc1.64001f,ec-3",AUDIO="atmos"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithoutChannels := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when no channel filter is given, expect unfiltered manifest",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithChannels,
+			expectManifestContent: manifestWithChannels,
+		},
+		{
+			name: "when a maximum of two channels is given, expect surround renditions and the variants " +
+				"referencing them removed",
+			filters:               &parsers.MediaFilters{AudioChannels: &parsers.ChannelRange{Max: 2}},
+			manifestContent:       manifestWithChannels,
+			expectManifestContent: manifestWithStereoOnly,
+		},
+		{
+			name:                  "when a minimum of three channels is given, expect stereo renditions removed",
+			filters:               &parsers.MediaFilters{AudioChannels: &parsers.ChannelRange{Min: 3, Max: math.MaxInt32}},
+			manifestContent:       manifestWithChannels,
+			expectManifestContent: manifestWithSurroundOnly,
+		},
+		{
+			name:                  "when renditions do not advertise their channels, expect them to be kept",
+			filters:               &parsers.MediaFilters{AudioChannels: &parsers.ChannelRange{Min: 3, Max: math.MaxInt32}},
+			manifestContent:       manifestWithoutChannels,
+			expectManifestContent: manifestWithoutChannels,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_VideoLevelFilter(t *testing.T) {
+	manifestWithLevels := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,AVERAGE-BANDWIDTH=4000,CODECS="avc1.640032,mp4a.40.2"
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=8000,AVERAGE-BANDWIDTH=8000,CODECS="hvc1.2.4.L150.B0,mp4a.40.2"
+http://existing.base/uri/link_3.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=12000,AVERAGE-BANDWIDTH=12000,CODECS="hvc1.2.4.L156.B0,mp4a.40.2"
+http://existing.base/uri/link_4.m3u8
+`
+
+	manifestWithCappedLevels := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=8000,AVERAGE-BANDWIDTH=8000,CODECS="hvc1.2.4.L150.B0,mp4a.40.2"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithCappedAVC := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=8000,AVERAGE-BANDWIDTH=8000,CODECS="hvc1.2.4.L150.B0,mp4a.40.2"
+http://existing.base/uri/link_3.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=12000,AVERAGE-BANDWIDTH=12000,CODECS="hvc1.2.4.L156.B0,mp4a.40.2"
+http://existing.base/uri/link_4.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when no video level filter is given, expect unfiltered manifest",
+			filters:               &parsers.MediaFilters{},
+			manifestContent:       manifestWithLevels,
+			expectManifestContent: manifestWithLevels,
+		},
+		{
+			name: "when maximum avc and hevc levels are given, expect variants above them removed",
+			filters: &parsers.MediaFilters{VideoLevels: []parsers.VideoLevel{
+				{Codec: "avc", Level: 4.0},
+				{Codec: "hevc", Level: 5.1},
+			}},
+			manifestContent:       manifestWithLevels,
+			expectManifestContent: manifestWithCappedLevels,
+		},
+		{
+			name:                  "when a maximum level is given for avc only, expect hevc variants kept",
+			filters:               &parsers.MediaFilters{VideoLevels: []parsers.VideoLevel{{Codec: "avc", Level: 4.0}}},
+			manifestContent:       manifestWithLevels,
+			expectManifestContent: manifestWithCappedAVC,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_CodecRegistry(t *testing.T) {
+	manifestWithNewCodecs := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="av01.0.08M.10,opus"
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=3000,AVERAGE-BANDWIDTH=3000,CODECS="vvc1.1.L51.CQA,mp4a.40.5"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithoutAV1 := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=3000,AVERAGE-BANDWIDTH=3000,CODECS="vvc1.1.L51.CQA,mp4a.40.5"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithoutHEAAC := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="av01.0.08M.10,opus"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithoutVVC := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="av01.0.08M.10,opus"
+http://existing.base/uri/link_2.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		codecs                config.Codecs
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when av1 is filtered, expect AV1 variants removed",
+			filters:               &parsers.MediaFilters{Videos: []parsers.VideoType{"av1"}},
+			manifestContent:       manifestWithNewCodecs,
+			expectManifestContent: manifestWithoutAV1,
+		},
+		{
+			name:                  "when opus is filtered, expect Opus variants removed",
+			filters:               &parsers.MediaFilters{Audios: []parsers.AudioType{"opus"}},
+			manifestContent:       manifestWithNewCodecs,
+			expectManifestContent: manifestWithoutAV1,
+		},
+		{
+			name:                  "when he-aac is filtered, expect AAC-LC variants kept",
+			filters:               &parsers.MediaFilters{Audios: []parsers.AudioType{"he-aac"}},
+			manifestContent:       manifestWithNewCodecs,
+			expectManifestContent: manifestWithoutHEAAC,
+		},
+		{
+			name:                  "when a codec unknown to the registry is filtered, expect unfiltered manifest",
+			filters:               &parsers.MediaFilters{Videos: []parsers.VideoType{"vvc"}},
+			manifestContent:       manifestWithNewCodecs,
+			expectManifestContent: manifestWithNewCodecs,
+		},
+		{
+			name:                  "when a codec added through config is filtered, expect its variants removed",
+			filters:               &parsers.MediaFilters{Videos: []parsers.VideoType{"vvc"}},
+			codecs:                config.Codecs{{Prefix: "vvc1", ContentType: "video", Aliases: []string{"vvc"}}},
+			manifestContent:       manifestWithNewCodecs,
+			expectManifestContent: manifestWithoutVVC,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{Codecs: tt.codecs})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_KeepFilter(t *testing.T) {
+	manifestWithAllTracks := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Spanish",DEFAULT=NO,LANGUAGE="es",URI="http://existing.base/uri/aac_es.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="French",DEFAULT=NO,LANGUAGE="fr",URI="http://existing.base/uri/aac_fr.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Spanish",DEFAULT=NO,LANGUAGE="es",URI="http://existing.base/uri/subs_es.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=3000,AVERAGE-BANDWIDTH=3000,CODECS="dvh1.05.06,ec-3",AUDIO="aac",SUBTITLES="subs"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithAVCAndHEVC := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Spanish",DEFAULT=NO,LANGUAGE="es",URI="http://existing.base/uri/aac_es.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="French",DEFAULT=NO,LANGUAGE="fr",URI="http://existing.base/uri/aac_fr.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Spanish",DEFAULT=NO,LANGUAGE="es",URI="http://existing.base/uri/subs_es.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithEC3Only := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Spanish",DEFAULT=NO,LANGUAGE="es",URI="http://existing.base/uri/aac_es.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="French",DEFAULT=NO,LANGUAGE="fr",URI="http://existing.base/uri/aac_fr.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Spanish",DEFAULT=NO,LANGUAGE="es",URI="http://existing.base/uri/subs_es.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=3000,AVERAGE-BANDWIDTH=3000,CODECS="dvh1.05.06,ec-3",AUDIO="aac",SUBTITLES="subs"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithEnglishOnly := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,AVERAGE-BANDWIDTH=2000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+http://existing.base/uri/link_2.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=3000,AVERAGE-BANDWIDTH=3000,CODECS="dvh1.05.06,ec-3",AUDIO="aac",SUBTITLES="subs"
+http://existing.base/uri/link_3.m3u8
+`
+
+	manifestWithEnglishAndSpanishAudio := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Spanish",DEFAULT=NO,LANGUAGE="es",URI="http://existing.base/uri/aac_es.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/subs_en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Spanish",DEFAULT=NO,LANGUAGE="es",URI="http://existing.base/uri/subs_es.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+http://existing.base/uri/link_1.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name:                  "when video codecs to keep are given, expect variants with other video codecs removed",
+			filters:               &parsers.MediaFilters{KeepVideos: []parsers.VideoType{"hevc", "avc"}},
+			manifestContent:       manifestWithAllTracks,
+			expectManifestContent: manifestWithAVCAndHEVC,
+		},
+		{
+			name:                  "when an audio codec to keep is given, expect variants with other audio codecs removed",
+			filters:               &parsers.MediaFilters{KeepAudios: []parsers.AudioType{"ec-3"}},
+			manifestContent:       manifestWithAllTracks,
+			expectManifestContent: manifestWithEC3Only,
+		},
+		{
+			name: "when languages to keep are given, expect audio and subtitle renditions in other " +
+				"languages removed",
+			filters: &parsers.MediaFilters{
+				KeepAudioLanguages:   []parsers.AudioLanguage{"EN"},
+				KeepCaptionLanguages: []parsers.CaptionLanguage{"en"},
+			},
+			manifestContent:       manifestWithAllTracks,
+			expectManifestContent: manifestWithEnglishOnly,
+		},
+		{
+			name: "when languages to keep and to exclude are given along with a codec to keep, expect " +
+				"every filter applied",
+			filters: &parsers.MediaFilters{
+				KeepVideos:         []parsers.VideoType{"avc"},
+				KeepAudioLanguages: []parsers.AudioLanguage{"en", "es", "fr"},
+				AudioLanguages:     []parsers.AudioLanguage{"fr"},
+			},
+			manifestContent:       manifestWithAllTracks,
+			expectManifestContent: manifestWithEnglishAndSpanishAudio,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_TrackBitrateFilter(t *testing.T) {
+	manifestWithAudioOnlyVariants := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=64000,AVERAGE-BANDWIDTH=60000,CODECS="mp4a.40.5"
+http://existing.base/uri/audio_64.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=384000,AVERAGE-BANDWIDTH=380000,CODECS="ec-3"
+http://existing.base/uri/audio_384.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1200000,AVERAGE-BANDWIDTH=900000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4500000,AVERAGE-BANDWIDTH=3800000,CODECS="avc1.640028,mp4a.40.2"
+http://existing.base/uri/link_2.m3u8
+`
+
+	manifestWithCappedVideo := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=64000,AVERAGE-BANDWIDTH=60000,CODECS="mp4a.40.5"
+http://existing.base/uri/audio_64.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=384000,AVERAGE-BANDWIDTH=380000,CODECS="ec-3"
+http://existing.base/uri/audio_384.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1200000,AVERAGE-BANDWIDTH=900000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/link_1.m3u8
+`
+
+	manifestWithCappedAudio := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=64000,AVERAGE-BANDWIDTH=60000,CODECS="mp4a.40.5"
+http://existing.base/uri/audio_64.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1200000,AVERAGE-BANDWIDTH=900000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4500000,AVERAGE-BANDWIDTH=3800000,CODECS="avc1.640028,mp4a.40.2"
+http://existing.base/uri/link_2.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name: "when a video bitrate range is given, expect only the video variants outside of it removed",
+			filters: &parsers.MediaFilters{
+				MaxBitrate:   math.MaxInt32,
+				VideoBitrate: &parsers.BitrateRange{Min: 0, Max: 4000000},
+			},
+			manifestContent:       manifestWithAudioOnlyVariants,
+			expectManifestContent: manifestWithCappedVideo,
+		},
+		{
+			name: "when the average bandwidth is asked for, expect it to be compared instead of the peak bandwidth",
+			filters: &parsers.MediaFilters{
+				MaxBitrate:       math.MaxInt32,
+				VideoBitrate:     &parsers.BitrateRange{Min: 0, Max: 4000000},
+				AverageBandwidth: true,
+			},
+			manifestContent:       manifestWithAudioOnlyVariants,
+			expectManifestContent: manifestWithAudioOnlyVariants,
+		},
+		{
+			name: "when an audio bitrate range is given, expect only the audio only variants outside of it removed",
+			filters: &parsers.MediaFilters{
+				MaxBitrate:   math.MaxInt32,
+				AudioBitrate: &parsers.BitrateRange{Min: 0, Max: 256000},
+			},
+			manifestContent:       manifestWithAudioOnlyVariants,
+			expectManifestContent: manifestWithCappedAudio,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_LadderSizeFilter(t *testing.T) {
+	manifestWithLadders := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=500,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/avc_500.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/avc_1000.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,CODECS="avc1.640028,mp4a.40.2"
+http://existing.base/uri/avc_2000.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,CODECS="avc1.640028,mp4a.40.2"
+http://existing.base/uri/avc_4000.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=6000,CODECS="avc1.640028,mp4a.40.2"
+http://existing.base/uri/avc_6000.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=3000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2"
+http://existing.base/uri/hevc_3000.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=5000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2"
+http://existing.base/uri/hevc_5000.m3u8
+`
+
+	manifestWithTopVariants := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,CODECS="avc1.640028,mp4a.40.2"
+http://existing.base/uri/avc_4000.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=6000,CODECS="avc1.640028,mp4a.40.2"
+http://existing.base/uri/avc_6000.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=3000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2"
+http://existing.base/uri/hevc_3000.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=5000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2"
+http://existing.base/uri/hevc_5000.m3u8
+`
+
+	manifestWithBottomVariant := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=500,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/avc_500.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=3000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2"
+http://existing.base/uri/hevc_3000.m3u8
+`
+
+	manifestWithSpreadVariants := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=500,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/avc_500.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,CODECS="avc1.640028,mp4a.40.2"
+http://existing.base/uri/avc_2000.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=6000,CODECS="avc1.640028,mp4a.40.2"
+http://existing.base/uri/avc_6000.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=3000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2"
+http://existing.base/uri/hevc_3000.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=5000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2"
+http://existing.base/uri/hevc_5000.m3u8
+`
+
+	manifestWithCappedAndSpreadAVC := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=500,CODECS="avc1.64001f,mp4a.40.2"
+http://existing.base/uri/avc_500.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,CODECS="avc1.640028,mp4a.40.2"
+http://existing.base/uri/avc_4000.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectErr             bool
+	}{
+		{
+			name: "when the ladder size is given, expect the highest variants of each codec ladder kept",
+			filters: &parsers.MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				LadderSize: &parsers.LadderSize{Count: 2, Selection: parsers.LadderTop},
+			},
+			manifestContent:       manifestWithLadders,
+			expectManifestContent: manifestWithTopVariants,
+		},
+		{
+			name: "when the bottom variants are asked for, expect the lowest variants of each codec ladder kept",
+			filters: &parsers.MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				LadderSize: &parsers.LadderSize{Count: 1, Selection: parsers.LadderBottom},
+			},
+			manifestContent:       manifestWithLadders,
+			expectManifestContent: manifestWithBottomVariant,
+		},
+		{
+			name: "when spread variants are asked for, expect the lowest, the highest and evenly spread " +
+				"variants in between kept",
+			filters: &parsers.MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				LadderSize: &parsers.LadderSize{Count: 3, Selection: parsers.LadderSpread},
+			},
+			manifestContent:       manifestWithLadders,
+			expectManifestContent: manifestWithSpreadVariants,
+		},
+		{
+			name: "when other filters are given, expect the ladder size applied to the variants left",
+			filters: &parsers.MediaFilters{
+				MaxBitrate: 4500,
+				LadderSize: &parsers.LadderSize{Count: 2, Selection: parsers.LadderSpread},
+				Videos:     []parsers.VideoType{"hvc1"},
+			},
+			manifestContent:       manifestWithLadders,
+			expectManifestContent: manifestWithCappedAndSpreadAVC,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
+
+func TestHLSFilter_FilterManifest_EmptyPolicy(t *testing.T) {
+	manifestWithTwoLadders := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=640x360,AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,CODECS="avc1.640028,ec-3",RESOLUTION=1920x1080,AUDIO="ec3"
+http://existing.base/uri/link_2.m3u8
+#EXT-X-I-FRAME-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=100,CODECS="avc1.64001f",RESOLUTION=640x360,URI="http://existing.base/uri/iframe_1.m3u8"
+`
+
+	manifestWithoutVariants := `#EXTM3U
+#EXT-X-VERSION:4
+`
+
+	manifestWithLowestVariant := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/aac_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=640x360,AUDIO="aac"
+http://existing.base/uri/link_1.m3u8
+`
+
+	manifestWithClosestVariant := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ec3",NAME="English",DEFAULT=YES,LANGUAGE="en",URI="http://existing.base/uri/ec3_en.m3u8"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=4000,CODECS="avc1.640028,ec-3",RESOLUTION=1920x1080,AUDIO="ec3"
+http://existing.base/uri/link_2.m3u8
+`
+
+	tests := []struct {
+		name                  string
+		filters               *parsers.MediaFilters
+		manifestContent       string
+		expectManifestContent string
+		expectFallback        bool
+		expectErr             bool
+	}{
+		{
+			name: "when every variant is filtered with the error policy, expect an error",
+			filters: &parsers.MediaFilters{
+				MaxBitrate:  math.MaxInt32,
+				Videos:      []parsers.VideoType{"avc"},
+				EmptyPolicy: parsers.EmptyPolicyError,
+			},
+			manifestContent: manifestWithTwoLadders,
+			expectErr:       true,
+		},
+		{
+			name: "when only I-frame variants are left with the error policy, expect an error",
+			filters: &parsers.MediaFilters{
+				MaxBitrate:  math.MaxInt32,
+				Audios:      []parsers.AudioType{"mp4a", "ec-3"},
+				EmptyPolicy: parsers.EmptyPolicyError,
+			},
+			manifestContent: manifestWithTwoLadders,
+			expectErr:       true,
+		},
+		{
+			name:                  "when every variant is filtered, expect a master playlist without variants by default",
+			filters:               &parsers.MediaFilters{MaxBitrate: math.MaxInt32, Videos: []parsers.VideoType{"avc"}},
+			manifestContent:       manifestWithTwoLadders,
+			expectManifestContent: manifestWithoutVariants,
+		},
+		{
+			name: "when every variant is filtered with a fallback and no bitrate, expect the lowest variant " +
+				"and its renditions",
+			filters: &parsers.MediaFilters{
+				MaxBitrate:  math.MaxInt32,
+				Videos:      []parsers.VideoType{"avc"},
+				EmptyPolicy: parsers.EmptyPolicyFallback,
+			},
+			manifestContent:       manifestWithTwoLadders,
+			expectManifestContent: manifestWithLowestVariant,
+			expectFallback:        true,
+		},
+		{
+			name: "when every variant is filtered with a fallback, expect the variant closest to the bitrate " +
+				"range and its renditions",
+			filters: &parsers.MediaFilters{
+				MinBitrate:  5000,
+				MaxBitrate:  8000,
+				EmptyPolicy: parsers.EmptyPolicyFallback,
+			},
+			manifestContent:       manifestWithTwoLadders,
+			expectManifestContent: manifestWithClosestVariant,
+			expectFallback:        true,
+		},
+		{
+			name: "when variants are left, expect the fallback not to be used",
+			filters: &parsers.MediaFilters{
+				MaxBitrate:        math.MaxInt32,
+				Audios:            []parsers.AudioType{"ec-3"},
+				FilterStreamTypes: []parsers.StreamType{"iframe"},
+				EmptyPolicy:       parsers.EmptyPolicyFallback,
+			},
+			manifestContent:       manifestWithTwoLadders,
+			expectManifestContent: manifestWithLowestVariant,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewHLSFilter("", tt.manifestContent, config.Config{})
+			manifest, err := filter.FilterManifest(tt.filters)
+
+			if err != nil && !tt.expectErr {
+				t.Errorf("FilterManifest() didnt expect an error to be returned, got: %v", err)
+				return
+			} else if err == nil && tt.expectErr {
+				t.Error("FilterManifest() expected an error, got nil")
+				return
+			}
+
+			if g, e := filter.UsedFallback(), tt.expectFallback; g != e {
+				t.Errorf("UsedFallback() wrong value returned\ngot %v\nexpected: %v", g, e)
+			}
+
+			if g, e := manifest, tt.expectManifestContent; g != e {
+				t.Errorf("FilterManifest() wrong manifest returned\ngot %v\nexpected: %v\ndiff: %v", g, e,
+					cmp.Diff(g, e))
+			}
+		})
+	}
+}
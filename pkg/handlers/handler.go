@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/cbsinteractive/bakery/pkg/config"
 	"github.com/cbsinteractive/bakery/pkg/filters"
@@ -10,6 +13,17 @@ import (
 	"github.com/cbsinteractive/bakery/pkg/parsers"
 )
 
+// deviceRuleHeader is the response header naming the device rule applied to the request
+const deviceRuleHeader = "X-Bakery-Device-Rule"
+
+// fallbackHeader is the response header set when the filters removed every playable
+// variant and the closest one was served instead
+const fallbackHeader = "X-Bakery-Fallback"
+
+// noPlayableVariantCode is the error code returned when the filters removed every
+// playable variant
+const noPlayableVariantCode = "no_playable_variant"
+
 // LoadHandler loads the handler for all the requests
 func LoadHandler(c config.Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -21,12 +35,36 @@ func LoadHandler(c config.Config) http.Handler {
 		logger.Infof("%s %s %s", r.Method, r.RequestURI, r.RemoteAddr)
 
 		// parse all the filters from the URL
-		masterManifestPath, mediaFilters, err := parsers.URLParse(r.URL.Path)
+		masterManifestPath, mediaFilters, err := parsers.URLParseWithQuery(r.URL.Path, r.URL.RawQuery, c.Presets)
 		if err != nil {
+			var parseErr *parsers.ParseError
+			if errors.As(err, &parseErr) {
+				filterError(c, w, parseErr)
+				return
+			}
+
 			httpError(c, w, err, "failed parsing url", http.StatusInternalServerError)
 			return
 		}
 
+		// select a preset from the device rules when the url does not name one
+		if len(c.DeviceRules) > 0 {
+			w.Header().Set("Vary", strings.Join(c.DeviceRules.HeaderNames(), ", "))
+		}
+
+		if hints := clientHints(c.DeviceRules.HeaderNames()); len(hints) > 0 {
+			w.Header().Set("Accept-CH", strings.Join(hints, ", "))
+		}
+
+		if rule, matched := c.DeviceRules.Match(r.Header); matched && mediaFilters.Preset == "" {
+			mediaFilters.Preset = rule.Preset
+			if err := mediaFilters.ApplyPreset(c.Presets); err != nil {
+				httpError(c, w, err, "failed applying device rule", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set(deviceRuleHeader, rule.Name)
+		}
+
 		//configure origin from path
 		manifestOrigin, err := origin.Configure(c, masterManifestPath)
 		if err != nil {
@@ -59,11 +97,18 @@ func LoadHandler(c config.Config) http.Handler {
 
 		// apply the filters to the origin manifest
 		filteredManifest, err := f.FilterManifest(mediaFilters)
-		if err != nil {
+		if errors.Is(err, filters.ErrNoPlayableVariant) {
+			noPlayableVariantError(c, w, err)
+			return
+		} else if err != nil {
 			httpError(c, w, err, "failed to filter manifest", http.StatusInternalServerError)
 			return
 		}
 
+		if f.UsedFallback() {
+			w.Header().Set(fallbackHeader, "true")
+		}
+
 		// write the filtered manifest to the response
 		fmt.Fprint(w, filteredManifest)
 	})
@@ -74,3 +119,52 @@ func httpError(c config.Config, w http.ResponseWriter, err error, message string
 	logger.WithError(err).Infof(message)
 	http.Error(w, message+": "+err.Error(), code)
 }
+
+// filterErrorResponse is the body returned when a filter of the url is malformed
+type filterErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// filterError responds with a 400 and a JSON body describing the malformed filter
+func filterError(c config.Config, w http.ResponseWriter, err *parsers.ParseError) {
+	logger := c.GetLogger()
+	logger.WithError(err).Infof("failed parsing url")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(filterErrorResponse{
+		Error: err.Error(),
+		Code:  string(err.Code),
+		Key:   err.Key,
+		Value: err.Value,
+	})
+}
+
+// noPlayableVariantError responds with a 422 and a JSON body explaining the filters
+// removed every playable variant
+func noPlayableVariantError(c config.Config, w http.ResponseWriter, err error) {
+	logger := c.GetLogger()
+	logger.WithError(err).Infof("failed to filter manifest")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(filterErrorResponse{
+		Error: err.Error(),
+		Code:  noPlayableVariantCode,
+	})
+}
+
+// clientHints returns the headers browsers only send when asked to with Accept-CH
+func clientHints(headers []string) []string {
+	var hints []string
+	for _, header := range headers {
+		if strings.HasPrefix(header, "Sec-Ch-") || header == "Ect" || header == "Save-Data" {
+			hints = append(hints, header)
+		}
+	}
+
+	return hints
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cbsinteractive/bakery/pkg/config"
+)
+
+func TestLoadHandler_deviceRules(t *testing.T) {
+	masterManifest := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,CODECS="avc1.640029,mp4a.40.2"
+avc.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2"
+hevc.m3u8
+`
+
+	manifestWithoutHEVC := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,CODECS="avc1.640029,mp4a.40.2"
+http://origin/avc.m3u8
+`
+
+	manifestWithoutAVC := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2"
+http://origin/hevc.m3u8
+`
+
+	manifestUnfiltered := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1000,CODECS="avc1.640029,mp4a.40.2"
+http://origin/avc.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=2000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2"
+http://origin/hevc.m3u8
+`
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(masterManifest))
+	}))
+	defer origin.Close()
+
+	var rules config.DeviceRules
+	err := rules.Decode(`[
+		{"name":"roku","headers":{"User-Agent":"Roku"},"preset":"no-hevc"},
+		{"name":"tv","headers":{"Sec-CH-UA-Platform":"Tizen"},"preset":"no-avc"}
+	]`)
+	if err != nil {
+		t.Fatalf("Decode() didnt expect an error to be returned, got: %v", err)
+	}
+
+	c := config.Config{
+		LogLevel:    "panic",
+		OriginHost:  origin.URL,
+		Presets:     config.Presets{"no-hevc": "/v(hvc)", "no-avc": "/v(avc)"},
+		DeviceRules: rules,
+	}
+
+	tests := []struct {
+		name                  string
+		path                  string
+		header                http.Header
+		expectManifestContent string
+		expectDeviceRule      string
+	}{
+		{
+			name:                  "when a device rule matches a request without preset, its preset is applied",
+			path:                  "/path/to/master.m3u8",
+			header:                http.Header{"User-Agent": {"Roku/DVP-9.10"}},
+			expectManifestContent: manifestWithoutHEVC,
+			expectDeviceRule:      "roku",
+		},
+		{
+			name:                  "when a device rule matches a request naming a preset, the url preset is applied",
+			path:                  "/p(no-avc)/path/to/master.m3u8",
+			header:                http.Header{"User-Agent": {"Roku/DVP-9.10"}},
+			expectManifestContent: manifestWithoutAVC,
+		},
+		{
+			name:                  "when no device rule matches, no preset is applied",
+			path:                  "/path/to/master.m3u8",
+			header:                http.Header{"User-Agent": {"Mozilla/5.0"}},
+			expectManifestContent: manifestUnfiltered,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header = tt.header
+			rec := httptest.NewRecorder()
+
+			LoadHandler(c).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("LoadHandler() wrong status returned, got %d, expected %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			// variants are made absolute against the test origin
+			expectManifestContent := strings.ReplaceAll(tt.expectManifestContent, "http://origin/", origin.URL+"/path/to/")
+			if g, e := rec.Body.String(), expectManifestContent; g != e {
+				t.Errorf("LoadHandler() wrong manifest returned\ngot %v\nexpected: %v", g, e)
+			}
+
+			if g, e := rec.Header().Get(deviceRuleHeader), tt.expectDeviceRule; g != e {
+				t.Errorf("LoadHandler() wrong %v header, got %q, expected %q", deviceRuleHeader, g, e)
+			}
+
+			if g, e := rec.Header().Get("Vary"), "Sec-Ch-Ua-Platform, User-Agent"; g != e {
+				t.Errorf("LoadHandler() wrong Vary header, got %q, expected %q", g, e)
+			}
+
+			if g, e := rec.Header().Get("Accept-CH"), "Sec-Ch-Ua-Platform"; g != e {
+				t.Errorf("LoadHandler() wrong Accept-CH header, got %q, expected %q", g, e)
+			}
+		})
+	}
+}
@@ -1,12 +1,17 @@
 package parsers
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"net/url"
 	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // VideoType is the video codec we need in a given playlist
@@ -24,6 +29,9 @@ type CaptionLanguage string
 // CaptionType is an allowed caption format for the stream
 type CaptionType string
 
+// VideoRange is the video dynamic range (e.g. sdr, pq, hlg)
+type VideoRange string
+
 // StreamType represents one stream type (e.g. video, audio, text)
 type StreamType string
 
@@ -49,43 +57,192 @@ const (
 	captionES   CaptionLanguage = "es-MX"
 	captionEN   CaptionLanguage = "en"
 
+	streamTypeIframe StreamType = "iframe"
+
 	// ProtocolHLS for manifest in hls
 	ProtocolHLS Protocol = "hls"
 	// ProtocolDASH for manifests in dash
 	ProtocolDASH Protocol = "dash"
 )
 
-// Trim is a struct that carries the start and end times to trim playlist
+// TrimBoundary is the way segments crossing the start or end time of a trim are handled
+type TrimBoundary string
+
+const (
+	// TrimOverlap keeps the segments that partly overlap the trim
+	TrimOverlap TrimBoundary = "overlap"
+	// TrimInside keeps only the segments that lie entirely within the trim
+	TrimInside TrimBoundary = "inside"
+)
+
+// Trim is a struct that carries the start and end times to trim playlist. The times are
+// Unix times matched against the program date time of the segments, or offsets in
+// seconds from the start of the playlist when Offset is set. Segments are kept when
+// they start within the trim, unless a Boundary says otherwise
 type Trim struct {
-	Start int64 `json:",omitempty"`
-	End   int64 `json:",omitempty"`
+	Start    int64        `json:",omitempty"`
+	End      int64        `json:",omitempty"`
+	Offset   bool         `json:",omitempty"`
+	Boundary TrimBoundary `json:",omitempty"`
+}
+
+// Resolution is a video resolution in pixels
+type Resolution struct {
+	Width  int `json:",omitempty"`
+	Height int `json:",omitempty"`
+}
+
+// ResolutionRange is a struct that carries the minimum and maximum video resolutions
+type ResolutionRange struct {
+	Min Resolution
+	Max Resolution
+}
+
+// FrameRateRange is a struct that carries the minimum and maximum video frame rates
+type FrameRateRange struct {
+	Min float64 `json:",omitempty"`
+	Max float64 `json:",omitempty"`
+}
+
+// ChannelRange is a struct that carries the minimum and maximum audio channel counts
+type ChannelRange struct {
+	Min int `json:",omitempty"`
+	Max int `json:",omitempty"`
+}
+
+// BitrateRange is a struct that carries the minimum and maximum bitrates of a track type
+type BitrateRange struct {
+	Min int `json:",omitempty"`
+	Max int `json:",omitempty"`
+}
+
+// LadderSelection is the way variants are picked when the ladder size is limited
+type LadderSelection string
+
+const (
+	// LadderTop keeps the variants with the highest bandwidths
+	LadderTop LadderSelection = "top"
+	// LadderBottom keeps the variants with the lowest bandwidths
+	LadderBottom LadderSelection = "bottom"
+	// LadderSpread keeps variants evenly spread by bandwidth, from the lowest to the highest
+	LadderSpread LadderSelection = "spread"
+)
+
+// LadderSize is a struct that carries the maximum number of variants of a ladder and the
+// way they are picked
+type LadderSize struct {
+	Count     int             `json:",omitempty"`
+	Selection LadderSelection `json:",omitempty"`
+}
+
+// EmptyPolicy is what happens when the filters remove every playable variant of a manifest
+type EmptyPolicy string
+
+const (
+	// EmptyPolicyError fails the request instead of serving a manifest with no variant
+	EmptyPolicyError EmptyPolicy = "error"
+	// EmptyPolicyFallback serves the origin variant closest to the filters
+	EmptyPolicyFallback EmptyPolicy = "fallback"
+	// EmptyPolicyAllow serves the manifest with no variant
+	EmptyPolicyAllow EmptyPolicy = "allow"
+)
+
+// VideoLevel is the maximum level allowed for a video codec family (e.g. avc, hevc)
+type VideoLevel struct {
+	Codec VideoType
+	Level float64
 }
 
 // MediaFilters is a struct that carry all the information passed via url
 type MediaFilters struct {
-	Videos            []VideoType       `json:",omitempty"`
-	Audios            []AudioType       `json:",omitempty"`
-	AudioLanguages    []AudioLanguage   `json:",omitempty"`
-	CaptionLanguages  []CaptionLanguage `json:",omitempty"`
-	CaptionTypes      []CaptionType     `json:",omitempty"`
-	FilterStreamTypes []StreamType      `json:",omitempty"`
-	MaxBitrate        int               `json:",omitempty"`
-	MinBitrate        int               `json:",omitempty"`
-	Plugins           []string          `json:",omitempty"`
-	Trim              *Trim             `json:",omitempty"`
-	Protocol          Protocol          `json:"protocol"`
+	Videos               []VideoType       `json:",omitempty"`
+	Audios               []AudioType       `json:",omitempty"`
+	AudioChannels        *ChannelRange     `json:",omitempty"`
+	VideoRanges          []VideoRange      `json:",omitempty"`
+	VideoLevels          []VideoLevel      `json:",omitempty"`
+	AudioLanguages       []AudioLanguage   `json:",omitempty"`
+	CaptionLanguages     []CaptionLanguage `json:",omitempty"`
+	CaptionTypes         []CaptionType     `json:",omitempty"`
+	FilterStreamTypes    []StreamType      `json:",omitempty"`
+	KeepVideos           []VideoType       `json:",omitempty"`
+	KeepAudios           []AudioType       `json:",omitempty"`
+	KeepAudioLanguages   []AudioLanguage   `json:",omitempty"`
+	KeepCaptionLanguages []CaptionLanguage `json:",omitempty"`
+	KeepCaptionTypes     []CaptionType     `json:",omitempty"`
+	MaxBitrate           int               `json:",omitempty"`
+	MinBitrate           int               `json:",omitempty"`
+	VideoBitrate         *BitrateRange     `json:",omitempty"`
+	AudioBitrate         *BitrateRange     `json:",omitempty"`
+	AverageBandwidth     bool              `json:",omitempty"`
+	Resolution           *ResolutionRange  `json:",omitempty"`
+	FrameRate            *FrameRateRange   `json:",omitempty"`
+	LadderSize           *LadderSize       `json:",omitempty"`
+	EmptyPolicy          EmptyPolicy       `json:",omitempty"`
+	Plugins              []string          `json:",omitempty"`
+	Preset               string            `json:",omitempty"`
+	Trim                 *Trim             `json:",omitempty"`
+	Protocol             Protocol          `json:"protocol"`
+}
+
+// ParseErrorCode is the machine-readable reason a filter of the url could not be parsed
+type ParseErrorCode string
+
+const (
+	// UnknownKeyCode is used for filters whose key is not supported
+	UnknownKeyCode ParseErrorCode = "unknown_key"
+	// ValueCountCode is used for filters given more values than they accept
+	ValueCountCode ParseErrorCode = "wrong_value_count"
+	// InvalidValueCode is used for values that are not formatted as the filter expects
+	InvalidValueCode ParseErrorCode = "invalid_value"
+	// OutOfRangeCode is used for numbers outside of the range accepted by the filter
+	OutOfRangeCode ParseErrorCode = "out_of_range"
+	// UnknownPresetCode is used for presets missing from the configuration
+	UnknownPresetCode ParseErrorCode = "unknown_preset"
+)
+
+// ParseError is returned by URLParse when a filter of the url is malformed
+type ParseError struct {
+	Code  ParseErrorCode
+	Key   string
+	Value string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Error parsing filter key: %v. Got error: %v", e.Key, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ParseError) Unwrap() error {
+	return e.Err
 }
 
-var urlParseRegexp = regexp.MustCompile(`(.*?)\((.*)\)`)
+var urlParseRegexp = regexp.MustCompile(`^([^()]*)\((.*)\)$`)
+
+const (
+	// jsonFiltersPrefix starts a path segment carrying base64url encoded JSON filters
+	jsonFiltersPrefix = "json="
+	// jsonFiltersKey is the query parameter carrying base64url encoded JSON filters
+	jsonFiltersKey = "json"
+	// queryFiltersPrefix can be added to the query parameters carrying filters, so that
+	// unknown keys are rejected instead of being ignored
+	queryFiltersPrefix = "bk."
+)
 
 // URLParse will generate a MediaFilters struct with
 // all the filters that needs to be applied to the
 // master manifest. It will also return the master manifest
 // url without the filters.
 func URLParse(urlpath string) (string, *MediaFilters, error) {
+	return URLParseWithQuery(urlpath, "", nil)
+}
+
+// URLParseWithQuery works as URLParse, also reading the filters given as query
+// parameters, e.g. ?v=avc&b=0,3000 or ?bk.v=avc&bk.b=0,3000. The preset selected with
+// p(name) is looked up in presets, which map preset names to filter paths
+func URLParseWithQuery(urlpath string, rawQuery string, presets map[string]string) (string, *MediaFilters, error) {
 	mf := new(MediaFilters)
 	parts := strings.Split(urlpath, "/")
-	re := urlParseRegexp
 	masterManifestPath := "/"
 
 	if strings.Contains(urlpath, ".m3u8") {
@@ -99,99 +256,570 @@ func URLParse(urlpath string) (string, *MediaFilters, error) {
 	mf.MaxBitrate = math.MaxInt32
 
 	for _, part := range parts {
-		// FindStringSubmatch should return a slice with
-		// the full string, the key and filters (3 elements).
-		// If it doesn't match, it means that the path is part
-		// of the official manifest path so we concatenate to it.
-		subparts := re.FindStringSubmatch(part)
-		if len(subparts) != 3 {
-			if mf.filterPlugins(part) {
-				continue
+		if strings.HasPrefix(part, jsonFiltersPrefix) {
+			if err := mf.parseJSON(strings.TrimPrefix(part, jsonFiltersPrefix)); err != nil {
+				return "", &MediaFilters{}, err
 			}
+			continue
+		}
+
+		isFilter, err := mf.parseSegment(part)
+		if err != nil {
+			return "", &MediaFilters{}, err
+		}
+
+		if !isFilter {
 			masterManifestPath = path.Join(masterManifestPath, part)
+		}
+	}
+
+	if err := mf.parseQuery(rawQuery); err != nil {
+		return "", &MediaFilters{}, err
+	}
+
+	if mf.Preset != "" {
+		if err := mf.ApplyPreset(presets); err != nil {
+			return "", &MediaFilters{}, err
+		}
+	}
+
+	return masterManifestPath, mf, nil
+}
+
+// parseSegment reads a filter or plugins segment of the url path. It returns false if
+// the segment is part of the manifest path instead
+func (f *MediaFilters) parseSegment(part string) (bool, error) {
+	// FindStringSubmatch should return a slice with
+	// the full string, the key and filters (3 elements).
+	// If it doesn't match, it means that the path is part
+	// of the official manifest path.
+	subparts := urlParseRegexp.FindStringSubmatch(part)
+	if len(subparts) != 3 {
+		return f.filterPlugins(part), nil
+	}
+
+	return true, f.parseFilter(subparts[1], subparts[2])
+}
+
+// parseQuery reads the filters given as query parameters, optionally prefixed with bk.
+// Unknown keys are ignored unless they have the prefix. The values are unescaped as path
+// segments so that + keeps marking the values to keep
+func (f *MediaFilters) parseQuery(rawQuery string) error {
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+
+		keyValue := strings.SplitN(param, "=", 2)
+		key, err := url.PathUnescape(keyValue[0])
+		if err != nil {
+			continue
+		}
+		prefixed := strings.HasPrefix(key, queryFiltersPrefix)
+		key = strings.TrimPrefix(key, queryFiltersPrefix)
+
+		var value string
+		if len(keyValue) == 2 {
+			value, err = url.PathUnescape(keyValue[1])
+			if err != nil {
+				return &ParseError{Code: InvalidValueCode, Key: key, Value: keyValue[1], Err: err}
+			}
+		}
+
+		if key == jsonFiltersKey {
+			err = f.parseJSON(value)
+		} else {
+			err = f.parseFilter(key, value)
+		}
+
+		var parseErr *ParseError
+		if !prefixed && errors.As(err, &parseErr) && parseErr.Code == UnknownKeyCode {
 			continue
 		}
 
-		filters := strings.Split(subparts[2], ",")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseJSON reads filters given as a base64url encoded MediaFilters JSON object. The
+// filters go through the path syntax so they are validated and combined with the others
+// the same way
+func (f *MediaFilters) parseJSON(encoded string) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return &ParseError{Code: InvalidValueCode, Key: jsonFiltersKey, Value: encoded, Err: err}
+	}
+
+	jsonFilters := MediaFilters{MaxBitrate: math.MaxInt32}
+	if err := json.Unmarshal(decoded, &jsonFilters); err != nil {
+		return &ParseError{Code: InvalidValueCode, Key: jsonFiltersKey, Value: encoded, Err: err}
+	}
+
+	for _, part := range strings.Split(jsonFilters.Path(), "/") {
+		if _, err := f.parseSegment(part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ApplyPreset sets the filters of the selected preset whose key was not given in the
+// url. The presets map preset names to filter paths
+func (f *MediaFilters) ApplyPreset(presets map[string]string) error {
+	presetPath, found := presets[f.Preset]
+	if !found {
+		return &ParseError{Code: UnknownPresetCode, Key: "p", Value: f.Preset, Err: fmt.Errorf("unknown preset %q", f.Preset)}
+	}
+
+	// the preset comes from the configuration, so its errors are not the client's
+	manifestPath, preset, err := URLParse(presetPath)
+	if err != nil {
+		return fmt.Errorf("parsing preset %q: %v", f.Preset, err)
+	}
+
+	if manifestPath != "/" {
+		return fmt.Errorf("preset %q holds a manifest path", f.Preset)
+	}
+
+	if f.Videos == nil && f.KeepVideos == nil {
+		f.Videos, f.KeepVideos = preset.Videos, preset.KeepVideos
+	}
+
+	if f.Audios == nil && f.KeepAudios == nil {
+		f.Audios, f.KeepAudios = preset.Audios, preset.KeepAudios
+	}
+
+	if f.AudioLanguages == nil && f.KeepAudioLanguages == nil {
+		f.AudioLanguages, f.KeepAudioLanguages = preset.AudioLanguages, preset.KeepAudioLanguages
+	}
+
+	if f.CaptionLanguages == nil && f.KeepCaptionLanguages == nil {
+		f.CaptionLanguages, f.KeepCaptionLanguages = preset.CaptionLanguages, preset.KeepCaptionLanguages
+	}
+
+	if f.CaptionTypes == nil && f.KeepCaptionTypes == nil {
+		f.CaptionTypes, f.KeepCaptionTypes = preset.CaptionTypes, preset.KeepCaptionTypes
+	}
+
+	if f.VideoRanges == nil {
+		f.VideoRanges = preset.VideoRanges
+	}
+
+	if f.VideoLevels == nil {
+		f.VideoLevels = preset.VideoLevels
+	}
+
+	if f.FilterStreamTypes == nil {
+		f.FilterStreamTypes = preset.FilterStreamTypes
+	}
+
+	if f.AudioChannels == nil {
+		f.AudioChannels = preset.AudioChannels
+	}
+
+	if f.MinBitrate == 0 && f.MaxBitrate == math.MaxInt32 && f.VideoBitrate == nil && f.AudioBitrate == nil &&
+		!f.AverageBandwidth {
+		f.MinBitrate, f.MaxBitrate = preset.MinBitrate, preset.MaxBitrate
+		f.VideoBitrate, f.AudioBitrate = preset.VideoBitrate, preset.AudioBitrate
+		f.AverageBandwidth = preset.AverageBandwidth
+	}
+
+	if f.Resolution == nil {
+		f.Resolution = preset.Resolution
+	}
+
+	if f.FrameRate == nil {
+		f.FrameRate = preset.FrameRate
+	}
+
+	if f.LadderSize == nil {
+		f.LadderSize = preset.LadderSize
+	}
+
+	if f.EmptyPolicy == "" {
+		f.EmptyPolicy = preset.EmptyPolicy
+	}
+
+	if f.Trim == nil {
+		f.Trim = preset.Trim
+	}
+
+	if f.Plugins == nil {
+		f.Plugins = preset.Plugins
+	}
+
+	return nil
+}
+
+// parseFilter reads the value of a filter key, e.g. avc,hevc for v(avc,hevc)
+func (f *MediaFilters) parseFilter(key, value string) error {
+	filters := strings.Split(value, ",")
+
+	var err error
+	switch key {
+	case "v":
+		exclude, keep := splitKeepValues(filters)
+		f.Videos = append(f.Videos, videoTypes(exclude)...)
+		f.KeepVideos = append(f.KeepVideos, videoTypes(keep)...)
+	case "vr":
+		for _, videoRange := range filters {
+			f.VideoRanges = append(f.VideoRanges, VideoRange(strings.ToLower(videoRange)))
+		}
+	case "vl":
+		for _, videoLevel := range filters {
+			codecLevel := strings.SplitN(videoLevel, ":", 2)
+			if len(codecLevel) != 2 || codecLevel[0] == "" {
+				return keyError(key, videoLevel, InvalidValueCode, fmt.Errorf("%q is not formatted as codec:level", videoLevel))
+			}
+
+			level, err := strconv.ParseFloat(codecLevel[1], 64)
+			if err != nil {
+				return keyError(key, videoLevel, InvalidValueCode, err)
+			}
+
+			if level <= 0 {
+				return keyError(key, videoLevel, OutOfRangeCode, fmt.Errorf("level must be positive"))
+			}
 
-		var err error
-		switch key := subparts[1]; key {
-		case "v":
-			for _, videoType := range filters {
-				if videoType == "hdr10" {
-					mf.Videos = append(mf.Videos, VideoType("hev1.2"), VideoType("hvc1.2"))
-					continue
-				}
+			f.VideoLevels = append(f.VideoLevels, VideoLevel{Codec: VideoType(codecLevel[0]), Level: level})
+		}
+	case "a":
+		exclude, keep := splitKeepValues(filters)
+		for _, audioType := range exclude {
+			f.Audios = append(f.Audios, AudioType(audioType))
+		}
 
-				mf.Videos = append(mf.Videos, VideoType(videoType))
+		for _, audioType := range keep {
+			f.KeepAudios = append(f.KeepAudios, AudioType(audioType))
+		}
+	case "ch":
+		if err := checkValueCount(key, filters, 2); err != nil {
+			return err
+		}
+
+		channels := ChannelRange{Max: math.MaxInt32}
+		if filters[0] != "" {
+			channels.Min, err = parseNonNegativeInt(key, filters[0])
+			if err != nil {
+				return err
 			}
-		case "a":
-			for _, audioType := range filters {
-				mf.Audios = append(mf.Audios, AudioType(audioType))
+		}
+
+		if len(filters) > 1 && filters[1] != "" {
+			channels.Max, err = parseNonNegativeInt(key, filters[1])
+			if err != nil {
+				return err
 			}
-		case "al":
-			for _, audioLanguage := range filters {
-				mf.AudioLanguages = append(mf.AudioLanguages, AudioLanguage(audioLanguage))
+		}
+
+		if channels.Min > channels.Max {
+			return keyError(key, value, OutOfRangeCode, fmt.Errorf("Min Channels is greater than Max Channels"))
+		}
+
+		f.AudioChannels = &channels
+	case "al":
+		exclude, keep := splitKeepValues(filters)
+		for _, audioLanguage := range exclude {
+			f.AudioLanguages = append(f.AudioLanguages, AudioLanguage(audioLanguage))
+		}
+
+		for _, audioLanguage := range keep {
+			f.KeepAudioLanguages = append(f.KeepAudioLanguages, AudioLanguage(audioLanguage))
+		}
+	case "c":
+		exclude, keep := splitKeepValues(filters)
+		for _, captionLanguage := range exclude {
+			f.CaptionLanguages = append(f.CaptionLanguages, CaptionLanguage(captionLanguage))
+		}
+
+		for _, captionLanguage := range keep {
+			f.KeepCaptionLanguages = append(f.KeepCaptionLanguages, CaptionLanguage(captionLanguage))
+		}
+	case "ct":
+		exclude, keep := splitKeepValues(filters)
+		if f.CaptionTypes == nil && len(keep) == 0 {
+			f.CaptionTypes = []CaptionType{}
+		}
+
+		for _, captionType := range exclude {
+			f.CaptionTypes = append(f.CaptionTypes, CaptionType(captionType))
+		}
+
+		for _, captionType := range keep {
+			f.KeepCaptionTypes = append(f.KeepCaptionTypes, CaptionType(captionType))
+		}
+	case "fs":
+		for _, streamType := range filters {
+			f.FilterStreamTypes = append(f.FilterStreamTypes, StreamType(streamType))
+		}
+	case "b":
+		// ranges are separated by ; and may apply to a track type only, as in
+		// b(video:500,6000;audio:64,256), while avg selects the average bandwidth
+		for _, part := range strings.Split(value, ";") {
+			trackType := ""
+			if typeRange := strings.SplitN(part, ":", 2); len(typeRange) == 2 {
+				trackType, part = typeRange[0], typeRange[1]
 			}
-		case "c":
-			for _, captionLanguage := range filters {
-				mf.CaptionLanguages = append(mf.CaptionLanguages, CaptionLanguage(captionLanguage))
+
+			if part == "avg" && trackType == "" {
+				f.AverageBandwidth = true
+				continue
 			}
-		case "ct":
-			if mf.CaptionTypes == nil {
-				mf.CaptionTypes = []CaptionType{}
+
+			bitrate, err := parseBitrateRange(key, part)
+			if err != nil {
+				return err
 			}
 
-			for _, captionType := range filters {
-				mf.CaptionTypes = append(mf.CaptionTypes, CaptionType(captionType))
+			switch trackType {
+			case "":
+				f.MinBitrate, f.MaxBitrate = bitrate.Min, bitrate.Max
+			case "video":
+				f.VideoBitrate = &bitrate
+			case "audio":
+				f.AudioBitrate = &bitrate
+			default:
+				return keyError(key, value, InvalidValueCode, fmt.Errorf("unknown track type %q", trackType))
 			}
-		case "fs":
-			for _, streamType := range filters {
-				mf.FilterStreamTypes = append(mf.FilterStreamTypes, StreamType(streamType))
+		}
+	case "res":
+		if err := checkValueCount(key, filters, 2); err != nil {
+			return err
+		}
+
+		resolution := ResolutionRange{Max: Resolution{Width: math.MaxInt32, Height: math.MaxInt32}}
+		if filters[0] != "" {
+			resolution.Min, err = parseResolution(filters[0])
+			if err != nil {
+				return keyError(key, filters[0], InvalidValueCode, err)
 			}
-		case "b":
-			if filters[0] != "" {
-				mf.MinBitrate, err = strconv.Atoi(filters[0])
-				if err != nil {
-					return keyError("trim", err)
-				}
+		}
+
+		if len(filters) > 1 && filters[1] != "" {
+			resolution.Max, err = parseResolution(filters[1])
+			if err != nil {
+				return keyError(key, filters[1], InvalidValueCode, err)
 			}
+		}
+
+		if resolution.Min.Width > resolution.Max.Width || resolution.Min.Height > resolution.Max.Height {
+			return keyError(key, value, OutOfRangeCode, fmt.Errorf("Min Resolution is greater than Max Resolution"))
+		}
+
+		f.Resolution = &resolution
+	case "fps":
+		if err := checkValueCount(key, filters, 2); err != nil {
+			return err
+		}
 
-			if filters[1] != "" {
-				mf.MaxBitrate, err = strconv.Atoi(filters[1])
-				if err != nil {
-					return keyError("trim", err)
-				}
+		frameRate := FrameRateRange{Max: math.MaxInt32}
+		if filters[0] != "" {
+			frameRate.Min, err = parseNonNegativeFloat(key, filters[0])
+			if err != nil {
+				return err
 			}
+		}
 
-			if isGreater(mf.MinBitrate, mf.MaxBitrate) {
-				return keyError("bitrate", fmt.Errorf("Min Bitrate is greater than or equal to Max Bitrate"))
+		if len(filters) > 1 && filters[1] != "" {
+			frameRate.Max, err = parseNonNegativeFloat(key, filters[1])
+			if err != nil {
+				return err
 			}
-		case "t":
-			var trim Trim
-			if filters[0] != "" {
-				trim.Start, err = strconv.ParseInt(filters[0], 10, 64)
-				if err != nil {
-					return keyError("trim", err)
-				}
+		}
+
+		if frameRate.Min > frameRate.Max {
+			return keyError(key, value, OutOfRangeCode, fmt.Errorf("Min Frame Rate is greater than Max Frame Rate"))
+		}
+
+		f.FrameRate = &frameRate
+	case "n":
+		if len(filters) > 2 {
+			return keyError(key, value, ValueCountCode, fmt.Errorf("expected a count and a selection, got %d values", len(filters)))
+		}
+
+		count, err := parseNonNegativeInt(key, filters[0])
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return keyError(key, value, OutOfRangeCode, fmt.Errorf("Ladder Size must be greater than 0"))
+		}
+
+		ladder := LadderSize{Count: count, Selection: LadderTop}
+		if len(filters) > 1 {
+			switch selection := LadderSelection(filters[1]); selection {
+			case LadderTop, LadderBottom, LadderSpread:
+				ladder.Selection = selection
+			default:
+				return keyError(key, filters[1], InvalidValueCode, fmt.Errorf("unknown selection %q", selection))
 			}
+		}
+
+		f.LadderSize = &ladder
+	case "ep":
+		if len(filters) != 1 {
+			return keyError(key, value, ValueCountCode, fmt.Errorf("expected a single policy, got %d values", len(filters)))
+		}
 
-			if filters[1] != "" {
-				trim.End, err = strconv.ParseInt(filters[1], 10, 64)
-				if err != nil {
-					return keyError("trim", err)
-				}
+		switch policy := EmptyPolicy(filters[0]); policy {
+		case EmptyPolicyError, EmptyPolicyFallback, EmptyPolicyAllow:
+			f.EmptyPolicy = policy
+		default:
+			return keyError(key, value, InvalidValueCode, fmt.Errorf("unknown policy %q", policy))
+		}
+	case "p":
+		if len(filters) != 1 {
+			return keyError(key, value, ValueCountCode, fmt.Errorf("expected a single preset name, got %d values", len(filters)))
+		}
+
+		if filters[0] == "" {
+			return keyError(key, value, InvalidValueCode, fmt.Errorf("preset name must not be empty"))
+		}
+
+		f.Preset = filters[0]
+	case "t":
+		if len(filters) < 2 || len(filters) > 4 {
+			return keyError(key, value, ValueCountCode, fmt.Errorf("expected a start and an end time, got %d values", len(filters)))
+		}
+
+		var trim Trim
+		kinds := map[trimTimeKind]bool{}
+		for i, field := range []*int64{&trim.Start, &trim.End} {
+			if filters[i] == "" {
+				continue
 			}
 
-			if isGreater(int(trim.Start), int(trim.End)) {
-				return keyError("trim", fmt.Errorf("Start Time is greater than or equal to End Time"))
+			var kind trimTimeKind
+			*field, kind, err = parseTrimTime(filters[i])
+			if err != nil {
+				return keyError(key, filters[i], InvalidValueCode, err)
 			}
+			kinds[kind] = true
+		}
+
+		if trim.Start < 0 || trim.End < 0 {
+			return keyError(key, value, OutOfRangeCode, fmt.Errorf("Start and End Times must not be negative"))
+		}
 
-			mf.Trim = &trim
+		if isGreater(int(trim.Start), int(trim.End)) {
+			return keyError(key, value, OutOfRangeCode, fmt.Errorf("Start Time is greater than or equal to End Time"))
+		}
+
+		var offsetOption bool
+		for _, option := range filters[2:] {
+			switch {
+			case option == "offset" && !offsetOption:
+				offsetOption = true
+			case (option == string(TrimOverlap) || option == string(TrimInside)) && trim.Boundary == "":
+				trim.Boundary = TrimBoundary(option)
+			default:
+				return keyError(key, option, InvalidValueCode, fmt.Errorf("unknown or repeated trim option %q", option))
+			}
 		}
+
+		// durations are offsets from the start of the playlist, which can't be mixed
+		// with the absolute times of timestamps
+		trim.Offset = offsetOption || kinds[offsetTrimTime]
+		if trim.Offset && kinds[absoluteTrimTime] {
+			return keyError(key, value, InvalidValueCode, fmt.Errorf("Start and End Times mix offsets and absolute times"))
+		}
+
+		f.Trim = &trim
+	default:
+		return keyError(key, value, UnknownKeyCode, fmt.Errorf("unknown filter key %q", key))
 	}
 
-	return masterManifestPath, mf, nil
+	return nil
+}
+
+// trimTimeKind tells whether a trim time was given as an absolute time, as an offset
+// from the start of the playlist or as plain seconds, which can be either
+type trimTimeKind int
+
+const (
+	secondsTrimTime trimTimeKind = iota
+	absoluteTrimTime
+	offsetTrimTime
+)
+
+// now returns the current time, which "now" trim times are relative to
+var now = time.Now
+
+// trimTimeRegexp matches the times relative to the current time, such as now-3600 or
+// now-PT1H
+var trimTimeRegexp = regexp.MustCompile(`^now(?:([+-])(.+))?$`)
+
+// parseTrimTime reads a trim time given either as Unix seconds, an ISO-8601 timestamp, an
+// ISO-8601 duration from the start of the playlist or a time relative to now, returning
+// it in seconds along with the kind of time it is
+func parseTrimTime(value string) (int64, trimTimeKind, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return seconds, secondsTrimTime, nil
+	}
+
+	if strings.HasPrefix(value, "P") {
+		duration, err := parseISODuration(value)
+		return int64(duration / time.Second), offsetTrimTime, err
+	}
+
+	if matches := trimTimeRegexp.FindStringSubmatch(value); matches != nil {
+		t := now()
+		if matches[1] != "" {
+			var shift time.Duration
+			if seconds, err := strconv.ParseInt(matches[2], 10, 64); err == nil {
+				shift = time.Duration(seconds) * time.Second
+			} else if shift, err = parseISODuration(matches[2]); err != nil {
+				return 0, absoluteTrimTime, err
+			}
+
+			if matches[1] == "-" {
+				shift = -shift
+			}
+			t = t.Add(shift)
+		}
+
+		return t.Unix(), absoluteTrimTime, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, absoluteTrimTime, fmt.Errorf("expected Unix seconds, an ISO-8601 time or duration, or a time relative to now")
+	}
+
+	return t.Unix(), absoluteTrimTime, nil
+}
+
+// isoDurationRegexp matches the ISO-8601 durations made of days, hours, minutes and seconds
+var isoDurationRegexp = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration reads an ISO-8601 duration such as PT10M or P1DT2H30M
+func parseISODuration(value string) (time.Duration, error) {
+	matches := isoDurationRegexp.FindStringSubmatch(value)
+	if matches == nil || value == "P" || value == "PT" {
+		return 0, fmt.Errorf("invalid ISO-8601 duration %q", value)
+	}
+
+	var duration time.Duration
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second}
+	for i, unit := range units {
+		if matches[i+1] == "" {
+			continue
+		}
+
+		amount, err := strconv.ParseFloat(matches[i+1], 64)
+		if err != nil {
+			return 0, err
+		}
+		duration += time.Duration(amount * float64(unit))
+	}
+
+	return duration, nil
 }
 
 // validate ranges like Trim and Bitrate
@@ -199,8 +827,158 @@ func isGreater(x int, y int) bool {
 	return x >= y
 }
 
-func keyError(key string, e error) (string, *MediaFilters, error) {
-	return "", &MediaFilters{}, fmt.Errorf("Error parsing filter key: %v. Got error: %w", key, e)
+// splitKeepValues separates the filter values prefixed with +, which define the tracks
+// to keep, from the ones defining the tracks to exclude
+func splitKeepValues(values []string) ([]string, []string) {
+	var exclude, keep []string
+	for _, value := range values {
+		if strings.HasPrefix(value, "+") {
+			keep = append(keep, strings.TrimPrefix(value, "+"))
+			continue
+		}
+
+		exclude = append(exclude, value)
+	}
+
+	return exclude, keep
+}
+
+// videoTypes converts the video filter values, expanding hdr10 to the HEVC Main 10 codecs
+func videoTypes(values []string) []VideoType {
+	var videos []VideoType
+	for _, videoType := range values {
+		if videoType == "hdr10" {
+			videos = append(videos, VideoType("hev1.2"), VideoType("hvc1.2"))
+			continue
+		}
+
+		videos = append(videos, VideoType(videoType))
+	}
+
+	return videos
+}
+
+// parseResolution reads a resolution formatted as WIDTHxHEIGHT, where 0 stands for 0x0
+func parseResolution(value string) (Resolution, error) {
+	if value == "0" {
+		return Resolution{}, nil
+	}
+
+	dimensions := strings.Split(value, "x")
+	if len(dimensions) != 2 {
+		return Resolution{}, fmt.Errorf("resolution %q is not formatted as WIDTHxHEIGHT", value)
+	}
+
+	width, err := strconv.Atoi(dimensions[0])
+	if err != nil {
+		return Resolution{}, err
+	}
+
+	height, err := strconv.Atoi(dimensions[1])
+	if err != nil {
+		return Resolution{}, err
+	}
+
+	if width < 0 || height < 0 {
+		return Resolution{}, fmt.Errorf("resolution %q must not be negative", value)
+	}
+
+	return Resolution{Width: width, Height: height}, nil
+}
+
+// parseBitrateRange reads a min,max bitrate range, where the maximum defaults to
+// math.MaxInt32
+func parseBitrateRange(key, value string) (BitrateRange, error) {
+	values := strings.Split(value, ",")
+	if err := checkValueCount(key, values, 2); err != nil {
+		return BitrateRange{}, err
+	}
+
+	var err error
+	bitrate := BitrateRange{Max: math.MaxInt32}
+	if values[0] != "" {
+		bitrate.Min, err = parseNonNegativeInt(key, values[0])
+		if err != nil {
+			return BitrateRange{}, err
+		}
+	}
+
+	if len(values) > 1 && values[1] != "" {
+		bitrate.Max, err = parseNonNegativeInt(key, values[1])
+		if err != nil {
+			return BitrateRange{}, err
+		}
+	}
+
+	// bitrates above math.MaxInt32 would be taken for an unset maximum
+	for i, b := range []int{bitrate.Min, bitrate.Max} {
+		if b > math.MaxInt32 {
+			return BitrateRange{}, keyError(key, values[i], OutOfRangeCode, fmt.Errorf("bitrate must not be greater than %d", math.MaxInt32))
+		}
+	}
+
+	if isGreater(bitrate.Min, bitrate.Max) {
+		return BitrateRange{}, keyError(key, value, OutOfRangeCode, fmt.Errorf("Min Bitrate is greater than or equal to Max Bitrate"))
+	}
+
+	return bitrate, nil
+}
+
+// checkValueCount returns a ParseError if more than max values are given to the filter key
+func checkValueCount(key string, values []string, max int) error {
+	if len(values) > max {
+		return &ParseError{
+			Code:  ValueCountCode,
+			Key:   key,
+			Value: strings.Join(values, ","),
+			Err:   fmt.Errorf("expected at most %d values, got %d", max, len(values)),
+		}
+	}
+
+	return nil
+}
+
+// parseNonNegativeInt reads an integer value of the filter key, which can't be negative
+func parseNonNegativeInt(key, value string) (int, error) {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, numberError(key, value, err)
+	}
+
+	if i < 0 {
+		return 0, &ParseError{Code: OutOfRangeCode, Key: key, Value: value, Err: fmt.Errorf("value must not be negative")}
+	}
+
+	return i, nil
+}
+
+// parseNonNegativeFloat reads a decimal value of the filter key, which can't be negative
+func parseNonNegativeFloat(key, value string) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, numberError(key, value, err)
+	}
+
+	if f < 0 {
+		return 0, &ParseError{Code: OutOfRangeCode, Key: key, Value: value, Err: fmt.Errorf("value must not be negative")}
+	}
+
+	return f, nil
+}
+
+// numberError returns the ParseError of a number that could not be parsed, numbers too
+// large to be held being out of range rather than invalid
+func numberError(key, value string, err error) error {
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) && numErr.Err == strconv.ErrRange {
+		return &ParseError{Code: OutOfRangeCode, Key: key, Value: value, Err: err}
+	}
+
+	return &ParseError{Code: InvalidValueCode, Key: key, Value: value, Err: err}
+}
+
+func keyError(key, value string, code ParseErrorCode, e error) error {
+	return &ParseError{Code: code, Key: key, Value: value, Err: e}
 }
 
 func (f *MediaFilters) filterPlugins(path string) bool {
@@ -217,9 +995,263 @@ func (f *MediaFilters) filterPlugins(path string) bool {
 	return false
 }
 
+//DefinesAudioDescriptionFilter will check if audio description tracks should be removed
+func (f *MediaFilters) DefinesAudioDescriptionFilter() bool {
+	for _, audioType := range f.Audios {
+		if audioType == audioNoAudioDescription {
+			return true
+		}
+	}
+
+	return false
+}
+
+//DefinesIframeFilter will check if I-frame (trick play) streams should be removed
+func (f *MediaFilters) DefinesIframeFilter() bool {
+	for _, streamType := range f.FilterStreamTypes {
+		if streamType == streamTypeIframe {
+			return true
+		}
+	}
+
+	return false
+}
+
 //DefinesBitrateFilter will check if bitrate filter is set
 func (f *MediaFilters) DefinesBitrateFilter() bool {
 	return (f.MinBitrate >= 0 && f.MaxBitrate <= math.MaxInt32) &&
 		(f.MinBitrate < f.MaxBitrate) &&
 		!(f.MinBitrate == 0 && f.MaxBitrate == math.MaxInt32)
 }
+
+//Includes will check if the given bitrate is within the range
+func (r *BitrateRange) Includes(bitrate int) bool {
+	return bitrate >= r.Min && bitrate <= r.Max
+}
+
+//Distance will return how far the given bitrate is from the range, 0 if it is within it
+func (r *BitrateRange) Distance(bitrate int) int {
+	switch {
+	case bitrate < r.Min:
+		return r.Min - bitrate
+	case bitrate > r.Max:
+		return bitrate - r.Max
+	}
+
+	return 0
+}
+
+//Includes will check if the given resolution is within the range
+func (r *ResolutionRange) Includes(width, height int) bool {
+	return width >= r.Min.Width && width <= r.Max.Width &&
+		height >= r.Min.Height && height <= r.Max.Height
+}
+
+//Includes will check if the given frame rate is within the range
+func (r *FrameRateRange) Includes(frameRate float64) bool {
+	return frameRate >= r.Min && frameRate <= r.Max
+}
+
+//Includes will check if the given channel count is within the range
+func (r *ChannelRange) Includes(channels int) bool {
+	return channels >= r.Min && channels <= r.Max
+}
+
+// Path returns the canonical url path of the filters, the inverse of URLParse. The
+// manifest path is to be appended to it
+func (f *MediaFilters) Path() string {
+	var segments []string
+	addSegment := func(key string, values ...string) {
+		segments = append(segments, fmt.Sprintf("%v(%v)", key, strings.Join(values, ",")))
+	}
+
+	if f.Videos != nil || f.KeepVideos != nil {
+		var values []string
+		for _, v := range f.Videos {
+			values = append(values, string(v))
+		}
+		for _, v := range f.KeepVideos {
+			values = append(values, "+"+string(v))
+		}
+		addSegment("v", values...)
+	}
+
+	if f.VideoRanges != nil {
+		var values []string
+		for _, vr := range f.VideoRanges {
+			values = append(values, string(vr))
+		}
+		addSegment("vr", values...)
+	}
+
+	if f.VideoLevels != nil {
+		var values []string
+		for _, vl := range f.VideoLevels {
+			values = append(values, string(vl.Codec)+":"+formatFloat(vl.Level))
+		}
+		addSegment("vl", values...)
+	}
+
+	if f.Audios != nil || f.KeepAudios != nil {
+		var values []string
+		for _, a := range f.Audios {
+			values = append(values, string(a))
+		}
+		for _, a := range f.KeepAudios {
+			values = append(values, "+"+string(a))
+		}
+		addSegment("a", values...)
+	}
+
+	if f.AudioChannels != nil {
+		addSegment("ch", formatInt(f.AudioChannels.Min, 0), formatMax(f.AudioChannels.Max))
+	}
+
+	if f.AudioLanguages != nil || f.KeepAudioLanguages != nil {
+		var values []string
+		for _, al := range f.AudioLanguages {
+			values = append(values, string(al))
+		}
+		for _, al := range f.KeepAudioLanguages {
+			values = append(values, "+"+string(al))
+		}
+		addSegment("al", values...)
+	}
+
+	if f.CaptionLanguages != nil || f.KeepCaptionLanguages != nil {
+		var values []string
+		for _, c := range f.CaptionLanguages {
+			values = append(values, string(c))
+		}
+		for _, c := range f.KeepCaptionLanguages {
+			values = append(values, "+"+string(c))
+		}
+		addSegment("c", values...)
+	}
+
+	if f.CaptionTypes != nil || f.KeepCaptionTypes != nil {
+		var values []string
+		for _, ct := range f.CaptionTypes {
+			values = append(values, string(ct))
+		}
+		for _, ct := range f.KeepCaptionTypes {
+			values = append(values, "+"+string(ct))
+		}
+		addSegment("ct", values...)
+	}
+
+	if f.FilterStreamTypes != nil {
+		var values []string
+		for _, fs := range f.FilterStreamTypes {
+			values = append(values, string(fs))
+		}
+		addSegment("fs", values...)
+	}
+
+	var bitrates []string
+	if f.DefinesBitrateFilter() {
+		bitrates = append(bitrates, formatInt(f.MinBitrate, 0)+","+formatInt(f.MaxBitrate, math.MaxInt32))
+	}
+	if f.VideoBitrate != nil {
+		bitrates = append(bitrates, "video:"+formatInt(f.VideoBitrate.Min, 0)+","+formatMax(f.VideoBitrate.Max))
+	}
+	if f.AudioBitrate != nil {
+		bitrates = append(bitrates, "audio:"+formatInt(f.AudioBitrate.Min, 0)+","+formatMax(f.AudioBitrate.Max))
+	}
+	if f.AverageBandwidth {
+		bitrates = append(bitrates, "avg")
+	}
+	if bitrates != nil {
+		addSegment("b", strings.Join(bitrates, ";"))
+	}
+
+	if f.Resolution != nil {
+		max := formatResolution(f.Resolution.Max, math.MaxInt32)
+		if f.Resolution.Max == (Resolution{}) {
+			max = ""
+		}
+		addSegment("res", formatResolution(f.Resolution.Min, 0), max)
+	}
+
+	if f.FrameRate != nil {
+		min, max := "", ""
+		if f.FrameRate.Min != 0 {
+			min = formatFloat(f.FrameRate.Min)
+		}
+		if f.FrameRate.Max != 0 && f.FrameRate.Max != math.MaxInt32 {
+			max = formatFloat(f.FrameRate.Max)
+		}
+		addSegment("fps", min, max)
+	}
+
+	if f.LadderSize != nil {
+		if f.LadderSize.Selection == "" || f.LadderSize.Selection == LadderTop {
+			addSegment("n", strconv.Itoa(f.LadderSize.Count))
+		} else {
+			addSegment("n", strconv.Itoa(f.LadderSize.Count), string(f.LadderSize.Selection))
+		}
+	}
+
+	if f.EmptyPolicy != "" {
+		addSegment("ep", string(f.EmptyPolicy))
+	}
+
+	if f.Trim != nil {
+		values := []string{strconv.FormatInt(f.Trim.Start, 10), strconv.FormatInt(f.Trim.End, 10)}
+		if f.Trim.Offset {
+			values = append(values, "offset")
+		}
+		if f.Trim.Boundary != "" {
+			values = append(values, string(f.Trim.Boundary))
+		}
+		addSegment("t", values...)
+	}
+
+	if f.Plugins != nil {
+		segments = append(segments, "["+strings.Join(f.Plugins, ",")+"]")
+	}
+
+	if f.Preset != "" {
+		addSegment("p", f.Preset)
+	}
+
+	if len(segments) == 0 {
+		return ""
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
+
+// formatInt formats a range boundary, leaving it empty when it is the default one
+func formatInt(value, defaultValue int) string {
+	if value == defaultValue {
+		return ""
+	}
+
+	return strconv.Itoa(value)
+}
+
+// formatMax formats the upper bound of a range, leaving it empty when it is open. Both
+// the parser default and the zero value of ranges decoded from JSON are open bounds
+func formatMax(value int) string {
+	if value == 0 {
+		return ""
+	}
+
+	return formatInt(value, math.MaxInt32)
+}
+
+// formatFloat formats a decimal with the fewest digits needed to parse it back
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// formatResolution formats a resolution range boundary as WIDTHxHEIGHT, leaving it
+// empty when both dimensions are the default one
+func formatResolution(r Resolution, defaultValue int) string {
+	if r.Width == defaultValue && r.Height == defaultValue {
+		return ""
+	}
+
+	return fmt.Sprintf("%dx%d", r.Width, r.Height)
+}
@@ -2,9 +2,11 @@ package parsers
 
 import (
 	"encoding/json"
+	"errors"
 	"math"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestURLParseUrl(t *testing.T) {
@@ -63,6 +65,101 @@ func TestURLParseUrl(t *testing.T) {
 			"/",
 			false,
 		},
+		{
+			"iframe stream type",
+			"/fs(iframe)/",
+			MediaFilters{
+				FilterStreamTypes: []StreamType{streamTypeIframe},
+				MaxBitrate:        math.MaxInt32,
+				MinBitrate:        0,
+			},
+			"/",
+			false,
+		},
+		{
+			"video ranges",
+			"/vr(SDR,hlg)/",
+			MediaFilters{
+				VideoRanges: []VideoRange{"sdr", "hlg"},
+				MaxBitrate:  math.MaxInt32,
+				MinBitrate:  0,
+			},
+			"/",
+			false,
+		},
+		{
+			"audio channel range",
+			"/ch(0,2)/",
+			MediaFilters{
+				AudioChannels: &ChannelRange{Max: 2},
+				MaxBitrate:    math.MaxInt32,
+				MinBitrate:    0,
+			},
+			"/",
+			false,
+		},
+		{
+			"audio channel range with minimum channels only",
+			"/ch(3)/",
+			MediaFilters{
+				AudioChannels: &ChannelRange{Min: 3, Max: math.MaxInt32},
+				MaxBitrate:    math.MaxInt32,
+				MinBitrate:    0,
+			},
+			"/",
+			false,
+		},
+		{
+			"audio channel range with minimum greater than maximum throws error",
+			"/ch(6,2)/",
+			MediaFilters{},
+			"",
+			true,
+		},
+		{
+			"video levels",
+			"/vl(avc:4.0,hevc:5.1)/",
+			MediaFilters{
+				VideoLevels: []VideoLevel{{Codec: "avc", Level: 4.0}, {Codec: "hevc", Level: 5.1}},
+				MaxBitrate:  math.MaxInt32,
+				MinBitrate:  0,
+			},
+			"/",
+			false,
+		},
+		{
+			"video level without a codec throws error",
+			"/vl(4.0)/",
+			MediaFilters{},
+			"",
+			true,
+		},
+		{
+			"video and audio types to keep",
+			"/v(+hdr10,+avc)/a(+ec-3)/",
+			MediaFilters{
+				KeepVideos: []VideoType{"hev1.2", "hvc1.2", "avc"},
+				KeepAudios: []AudioType{"ec-3"},
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 0,
+			},
+			"/",
+			false,
+		},
+		{
+			"languages and caption types to keep alongside excluded ones",
+			"/al(+en,+pt-BR,es)/c(+en)/ct(+wvtt)/",
+			MediaFilters{
+				AudioLanguages:       []AudioLanguage{"es"},
+				KeepAudioLanguages:   []AudioLanguage{audioLangEN, audioLangPTBR},
+				KeepCaptionLanguages: []CaptionLanguage{captionEN},
+				KeepCaptionTypes:     []CaptionType{"wvtt"},
+				MaxBitrate:           math.MaxInt32,
+				MinBitrate:           0,
+			},
+			"/",
+			false,
+		},
 		{
 			"bitrate range with minimum bitrate only",
 			"/b(100,)/",
@@ -73,6 +170,125 @@ func TestURLParseUrl(t *testing.T) {
 			"/",
 			false,
 		},
+		{
+			"bitrate range with a single value sets the minimum bitrate",
+			"/b(500)/",
+			MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 500,
+			},
+			"/",
+			false,
+		},
+		{
+			"bitrate ranges for video and audio tracks",
+			"/b(video:500,6000;audio:64,)/",
+			MediaFilters{
+				VideoBitrate: &BitrateRange{Min: 500, Max: 6000},
+				AudioBitrate: &BitrateRange{Min: 64, Max: math.MaxInt32},
+				MaxBitrate:   math.MaxInt32,
+				MinBitrate:   0,
+			},
+			"/",
+			false,
+		},
+		{
+			"bitrate range of the average bandwidth",
+			"/b(0,3000;avg)/",
+			MediaFilters{
+				MaxBitrate:       3000,
+				MinBitrate:       0,
+				AverageBandwidth: true,
+			},
+			"/",
+			false,
+		},
+		{
+			"bitrate range for an unknown track type throws error",
+			"/b(text:0,100)/",
+			MediaFilters{},
+			"",
+			true,
+		},
+		{
+			"video bitrate range with minimum greater than maximum throws error",
+			"/b(video:6000,500)/",
+			MediaFilters{},
+			"",
+			true,
+		},
+		{
+			"ladder size keeps the top variants by default",
+			"/n(4)/",
+			MediaFilters{
+				LadderSize: &LadderSize{Count: 4, Selection: LadderTop},
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 0,
+			},
+			"/",
+			false,
+		},
+		{
+			"ladder size with evenly spread variants",
+			"/n(6,spread)/",
+			MediaFilters{
+				LadderSize: &LadderSize{Count: 6, Selection: LadderSpread},
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 0,
+			},
+			"/",
+			false,
+		},
+		{
+			"ladder size with an unknown selection throws error",
+			"/n(4,middle)/",
+			MediaFilters{},
+			"",
+			true,
+		},
+		{
+			"empty ladder size throws error",
+			"/n(0)/",
+			MediaFilters{},
+			"",
+			true,
+		},
+		{
+			"empty manifest policy",
+			"/ep(fallback)/",
+			MediaFilters{
+				EmptyPolicy: EmptyPolicyFallback,
+				MaxBitrate:  math.MaxInt32,
+				MinBitrate:  0,
+			},
+			"/",
+			false,
+		},
+		{
+			"unknown empty manifest policy throws error",
+			"/ep(ignore)/",
+			MediaFilters{},
+			"",
+			true,
+		},
+		{
+			"unknown filter key throws error",
+			"/x(foo)/path/to/test.m3u8",
+			MediaFilters{},
+			"",
+			true,
+		},
+		{
+			"origin path segments with parentheses are kept in the manifest path",
+			"/path/to/test(1).m3u8",
+			MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 0,
+				Protocol:   ProtocolHLS,
+			},
+			"/path/to/test(1).m3u8",
+			false,
+		},
 		{
 			"bitrate range with maximum bitrate only",
 			"/b(,3000)/",
@@ -97,6 +313,90 @@ func TestURLParseUrl(t *testing.T) {
 			"",
 			true,
 		},
+		{
+			"resolution range",
+			"/res(640x360,1920x1080)/",
+			MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 0,
+				Resolution: &ResolutionRange{
+					Min: Resolution{Width: 640, Height: 360},
+					Max: Resolution{Width: 1920, Height: 1080},
+				},
+			},
+			"/",
+			false,
+		},
+		{
+			"resolution range with maximum resolution only",
+			"/res(0,1920x1080)/",
+			MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 0,
+				Resolution: &ResolutionRange{
+					Max: Resolution{Width: 1920, Height: 1080},
+				},
+			},
+			"/",
+			false,
+		},
+		{
+			"resolution range with minimum resolution only",
+			"/res(1280x720)/",
+			MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 0,
+				Resolution: &ResolutionRange{
+					Min: Resolution{Width: 1280, Height: 720},
+					Max: Resolution{Width: math.MaxInt32, Height: math.MaxInt32},
+				},
+			},
+			"/",
+			false,
+		},
+		{
+			"resolution range with minimum greater than maximum throws error",
+			"/res(1920x1080,1280x720)/",
+			MediaFilters{},
+			"",
+			true,
+		},
+		{
+			"malformed resolution throws error",
+			"/res(0,1080p)/",
+			MediaFilters{},
+			"",
+			true,
+		},
+		{
+			"frame rate range",
+			"/fps(0,30)/",
+			MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 0,
+				FrameRate:  &FrameRateRange{Max: 30},
+			},
+			"/",
+			false,
+		},
+		{
+			"frame rate range with minimum frame rate only",
+			"/fps(29.97,)/",
+			MediaFilters{
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 0,
+				FrameRate:  &FrameRateRange{Min: 29.97, Max: math.MaxInt32},
+			},
+			"/",
+			false,
+		},
+		{
+			"frame rate range with minimum greater than maximum throws error",
+			"/fps(60,30)/",
+			MediaFilters{},
+			"",
+			true,
+		},
 		{
 			"trim filter",
 			"/t(100,1000)/path/to/test.m3u8",
@@ -126,6 +426,30 @@ func TestURLParseUrl(t *testing.T) {
 			"",
 			true,
 		},
+		{
+			"trim filter by media time offsets keeping the overlapping segments",
+			"/t(600,1500,offset,overlap)/path/to/test.m3u8",
+			MediaFilters{
+				Protocol:   ProtocolHLS,
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 0,
+				Trim: &Trim{
+					Start:    600,
+					End:      1500,
+					Offset:   true,
+					Boundary: TrimOverlap,
+				},
+			},
+			"/path/to/test.m3u8",
+			false,
+		},
+		{
+			"trim filter with conflicting boundaries throws error",
+			"/t(600,1500,overlap,inside)/path/to/test.m3u8",
+			MediaFilters{},
+			"",
+			true,
+		},
 		{
 			"detect a signle plugin for execution from url",
 			"[plugin1]/some/path/master.m3u8",
@@ -230,3 +554,548 @@ func TestURLParseUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestURLParseErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expectedErr ParseError
+	}{
+		{
+			name:        "unknown filter key",
+			input:       "/x(foo)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: UnknownKeyCode, Key: "x", Value: "foo"},
+		},
+		{
+			name:        "too many bitrate values",
+			input:       "/b(100,200,300)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: ValueCountCode, Key: "b", Value: "100,200,300"},
+		},
+		{
+			name:        "trim without an end time",
+			input:       "/t(100)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: ValueCountCode, Key: "t", Value: "100"},
+		},
+		{
+			name:        "unknown trim option",
+			input:       "/t(100,1000,partial)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: InvalidValueCode, Key: "t", Value: "partial"},
+		},
+		{
+			name:        "bitrate that is not a number",
+			input:       "/b(100,high)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: InvalidValueCode, Key: "b", Value: "high"},
+		},
+		{
+			name:        "negative bitrate",
+			input:       "/b(-100,)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: OutOfRangeCode, Key: "b", Value: "-100"},
+		},
+		{
+			name:        "bitrate too large for the range",
+			input:       "/b(0,99999999999)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: OutOfRangeCode, Key: "b", Value: "99999999999"},
+		},
+		{
+			name:        "video bitrate too large for the range",
+			input:       "/b(video:99999999999,)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: OutOfRangeCode, Key: "b", Value: "99999999999"},
+		},
+		{
+			name:        "channel count overflowing an integer",
+			input:       "/ch(2,99999999999999999999)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: OutOfRangeCode, Key: "ch", Value: "99999999999999999999"},
+		},
+		{
+			name:        "several preset names",
+			input:       "/p(roku,tizen)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: ValueCountCode, Key: "p", Value: "roku,tizen"},
+		},
+		{
+			name:        "empty preset name",
+			input:       "/p()/path/to/test.m3u8",
+			expectedErr: ParseError{Code: InvalidValueCode, Key: "p", Value: ""},
+		},
+		{
+			name:        "unknown preset",
+			input:       "/p(roku)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: UnknownPresetCode, Key: "p", Value: "roku"},
+		},
+		{
+			name:        "minimum frame rate above the maximum",
+			input:       "/fps(60,30)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: OutOfRangeCode, Key: "fps", Value: "60,30"},
+		},
+		{
+			name:        "negative channel count",
+			input:       "/ch(,-2)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: OutOfRangeCode, Key: "ch", Value: "-2"},
+		},
+		{
+			name:        "unknown empty manifest policy",
+			input:       "/ep(ignore)/path/to/test.m3u8",
+			expectedErr: ParseError{Code: InvalidValueCode, Key: "ep", Value: "ignore"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := URLParse(test.input)
+
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a ParseError, got: %v", err)
+			}
+
+			if parseErr.Code != test.expectedErr.Code || parseErr.Key != test.expectedErr.Key ||
+				parseErr.Value != test.expectedErr.Value {
+				t.Errorf("wrong error returned.\nwant %+v\ngot %+v", test.expectedErr, *parseErr)
+			}
+		})
+	}
+}
+
+func TestMediaFiltersPath(t *testing.T) {
+	tests := []struct {
+		name         string
+		filters      MediaFilters
+		expectedPath string
+	}{
+		{
+			name:         "no filters",
+			filters:      MediaFilters{MaxBitrate: math.MaxInt32},
+			expectedPath: "",
+		},
+		{
+			name: "codecs and languages to exclude and to keep",
+			filters: MediaFilters{
+				Videos:               []VideoType{"hev1.2", "hvc1.2"},
+				KeepVideos:           []VideoType{"avc"},
+				KeepAudios:           []AudioType{"ec-3"},
+				AudioLanguages:       []AudioLanguage{"es"},
+				KeepCaptionLanguages: []CaptionLanguage{"en"},
+				CaptionTypes:         []CaptionType{"stpp"},
+				MaxBitrate:           math.MaxInt32,
+			},
+			expectedPath: "/v(hev1.2,hvc1.2,+avc)/a(+ec-3)/al(es)/c(+en)/ct(stpp)",
+		},
+		{
+			name: "ranges with default boundaries",
+			filters: MediaFilters{
+				AudioChannels: &ChannelRange{Min: 0, Max: 2},
+				MinBitrate:    100,
+				MaxBitrate:    math.MaxInt32,
+				Resolution:    &ResolutionRange{Min: Resolution{Width: 1280, Height: 720}, Max: Resolution{Width: math.MaxInt32, Height: math.MaxInt32}},
+				FrameRate:     &FrameRateRange{Min: 29.97, Max: math.MaxInt32},
+			},
+			expectedPath: "/ch(,2)/b(100,)/res(1280x720,)/fps(29.97,)",
+		},
+		{
+			name: "video ranges, levels, stream types, trim and plugins",
+			filters: MediaFilters{
+				VideoRanges:       []VideoRange{"sdr", "hlg"},
+				VideoLevels:       []VideoLevel{{Codec: "avc", Level: 4}, {Codec: "hevc", Level: 5.1}},
+				FilterStreamTypes: []StreamType{"iframe"},
+				MinBitrate:        0,
+				MaxBitrate:        4000,
+				Trim:              &Trim{Start: 100, End: 1000},
+				Plugins:           []string{"plugin1", "plugin2"},
+			},
+			expectedPath: "/vr(sdr,hlg)/vl(avc:4,hevc:5.1)/fs(iframe)/b(,4000)/t(100,1000)/[plugin1,plugin2]",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			if g, e := test.filters.Path(), test.expectedPath; g != e {
+				t.Errorf("wrong path generated.\nwant %q\ngot %q", e, g)
+			}
+		})
+	}
+}
+
+func TestMediaFiltersPathRoundTrip(t *testing.T) {
+	inputs := []string{
+		"/path/to/test.m3u8",
+		"/v(hdr10,hevc,+avc)/a(aac,noAd)/path/to/test.m3u8",
+		"/vr(sdr,pq)/vl(avc:4.0,hevc:5.1)/path/to/test.mpd",
+		"/al(pt-BR,+en)/c(+en,es)/ct(stpp,+wvtt)/fs(iframe,text)/path/to/test.m3u8",
+		"/ch(3,)/b(100,4000)/res(0,1920x1080)/fps(23.976,30)/path/to/test.mpd",
+		"/ct()/b(,3000)/t(100,1000)/[plugin1,plugin2]/path/to/test.m3u8",
+		"/b(100,;video:500,6000;audio:,256;avg)/path/to/test.m3u8",
+		"/n(4)/path/to/test.m3u8",
+		"/n(4,bottom)/path/to/test.mpd",
+		"/v(avc)/ep(error)/path/to/test.m3u8",
+		"/b(6000,)/ep(allow)/path/to/test.mpd",
+		"/t(0,600,offset)/path/to/test.m3u8",
+		"/t(100,1000,inside)/path/to/test.m3u8",
+	}
+
+	for _, input := range inputs {
+		input := input
+		t.Run(input, func(t *testing.T) {
+			manifestPath, filters, err := URLParse(input)
+			if err != nil {
+				t.Fatalf("Did not expect an error returned, got: %v", err)
+			}
+
+			serialized := filters.Path() + manifestPath
+			roundTripPath, roundTripFilters, err := URLParse(serialized)
+			if err != nil {
+				t.Fatalf("Did not expect an error parsing %q, got: %v", serialized, err)
+			}
+
+			if roundTripPath != manifestPath {
+				t.Errorf("wrong master manifest generated.\nwant %#v\ngot %#v", manifestPath, roundTripPath)
+			}
+
+			if !reflect.DeepEqual(roundTripFilters, filters) {
+				t.Errorf("wrong struct generated from %q.\nwant %#v\ngot %#v", serialized, filters, roundTripFilters)
+			}
+		})
+	}
+}
+
+func TestURLParseWithQuery(t *testing.T) {
+	// {"Videos":["avc"],"MaxBitrate":3000,"Trim":{"Start":100,"End":1000}}
+	jsonFilters := "eyJWaWRlb3MiOlsiYXZjIl0sIk1heEJpdHJhdGUiOjMwMDAsIlRyaW0iOnsiU3RhcnQiOjEwMCwiRW5kIjoxMDAwfX0"
+
+	// {"LadderSize":{"Count":4},"AudioChannels":{"Min":2},"VideoBitrate":{"Min":500},"FrameRate":{"Min":30},"Resolution":{"Min":{"Width":640,"Height":360}}}
+	partialJSONFilters := "eyJMYWRkZXJTaXplIjp7IkNvdW50Ijo0fSwiQXVkaW9DaGFubmVscyI6eyJNaW4iOjJ9LCJWaWRlb0JpdHJhdGUiOnsiTWluIjo1MDB9LCJGcmFtZVJhdGUiOnsiTWluIjozMH0sIlJlc29sdXRpb24iOnsiTWluIjp7IldpZHRoIjo2NDAsIkhlaWdodCI6MzYwfX19"
+
+	tests := []struct {
+		name                 string
+		input                string
+		query                string
+		expectedFilters      MediaFilters
+		expectedManifestPath string
+		expectedErr          bool
+	}{
+		{
+			name:  "filters given as query parameters",
+			input: "/path/to/test.m3u8",
+			query: "v=avc&b=0,3000",
+			expectedFilters: MediaFilters{
+				Videos:     []VideoType{videoH264},
+				MaxBitrate: 3000,
+				MinBitrate: 0,
+				Protocol:   ProtocolHLS,
+			},
+			expectedManifestPath: "/path/to/test.m3u8",
+		},
+		{
+			name:  "filters given as query parameters with the filters prefix",
+			input: "/path/to/test.m3u8",
+			query: "bk.v=avc&b=0,3000",
+			expectedFilters: MediaFilters{
+				Videos:     []VideoType{videoH264},
+				MaxBitrate: 3000,
+				MinBitrate: 0,
+				Protocol:   ProtocolHLS,
+			},
+			expectedManifestPath: "/path/to/test.m3u8",
+		},
+		{
+			name:  "values to keep given as query parameters, with + escaped or not",
+			input: "/path/to/test.m3u8",
+			query: "bk.v=%2Bhevc,+avc",
+			expectedFilters: MediaFilters{
+				KeepVideos: []VideoType{videoHEVC, videoH264},
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 0,
+				Protocol:   ProtocolHLS,
+			},
+			expectedManifestPath: "/path/to/test.m3u8",
+		},
+		{
+			name:  "unknown query parameters without the filters prefix are ignored",
+			input: "/path/to/test.mpd",
+			query: "token=abc123&_=1700000000&a=ec-3",
+			expectedFilters: MediaFilters{
+				Audios:     []AudioType{"ec-3"},
+				MaxBitrate: math.MaxInt32,
+				MinBitrate: 0,
+				Protocol:   ProtocolDASH,
+			},
+			expectedManifestPath: "/path/to/test.mpd",
+		},
+		{
+			name:  "filters given as a base64url encoded JSON path segment",
+			input: "/json=" + jsonFilters + "/path/to/test.m3u8",
+			expectedFilters: MediaFilters{
+				Videos:     []VideoType{videoH264},
+				MaxBitrate: 3000,
+				MinBitrate: 0,
+				Trim:       &Trim{Start: 100, End: 1000},
+				Protocol:   ProtocolHLS,
+			},
+			expectedManifestPath: "/path/to/test.m3u8",
+		},
+		{
+			name:  "JSON filters without upper bounds or ladder selection leave them open",
+			input: "/json=" + partialJSONFilters + "/path/to/test.m3u8",
+			expectedFilters: MediaFilters{
+				Resolution: &ResolutionRange{
+					Min: Resolution{Width: 640, Height: 360},
+					Max: Resolution{Width: math.MaxInt32, Height: math.MaxInt32},
+				},
+				FrameRate:     &FrameRateRange{Min: 30, Max: math.MaxInt32},
+				AudioChannels: &ChannelRange{Min: 2, Max: math.MaxInt32},
+				VideoBitrate:  &BitrateRange{Min: 500, Max: math.MaxInt32},
+				LadderSize:    &LadderSize{Count: 4, Selection: LadderTop},
+				MaxBitrate:    math.MaxInt32,
+				MinBitrate:    0,
+				Protocol:      ProtocolHLS,
+			},
+			expectedManifestPath: "/path/to/test.m3u8",
+		},
+		{
+			name:  "filters given in the path, as JSON and as query parameters are combined",
+			input: "/v(hevc)/a(aac)/json=" + jsonFilters + "/path/to/test.m3u8",
+			query: "al=es&json=" + jsonFilters,
+			expectedFilters: MediaFilters{
+				Videos:         []VideoType{videoHEVC, videoH264, videoH264},
+				Audios:         []AudioType{audioAAC},
+				AudioLanguages: []AudioLanguage{"es"},
+				MaxBitrate:     3000,
+				MinBitrate:     0,
+				Trim:           &Trim{Start: 100, End: 1000},
+				Protocol:       ProtocolHLS,
+			},
+			expectedManifestPath: "/path/to/test.m3u8",
+		},
+		{
+			name:        "malformed filter given as a query parameter throws error",
+			input:       "/path/to/test.m3u8",
+			query:       "b=0,high",
+			expectedErr: true,
+		},
+		{
+			name:        "malformed filter given with the filters prefix throws error",
+			input:       "/path/to/test.m3u8",
+			query:       "bk.b=0,high",
+			expectedErr: true,
+		},
+		{
+			name:        "unknown filter key given with the filters prefix throws error",
+			input:       "/path/to/test.m3u8",
+			query:       "bk.zz=1",
+			expectedErr: true,
+		},
+		{
+			name:        "JSON path segment that can't be decoded throws error",
+			input:       "/json=e30-invalid/path/to/test.m3u8",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			masterManifestPath, output, err := URLParseWithQuery(test.input, test.query, nil)
+			if !test.expectedErr && err != nil {
+				t.Errorf("Did not expect an error returned, got: %v", err)
+				return
+			} else if test.expectedErr && err == nil {
+				t.Errorf("Expected an error returned, got nil")
+				return
+			}
+
+			if test.expectedManifestPath != masterManifestPath {
+				t.Errorf("wrong master manifest generated.\nwant %#v\ngot %#v", test.expectedManifestPath, masterManifestPath)
+			}
+
+			if !reflect.DeepEqual(*output, test.expectedFilters) {
+				t.Errorf("wrong struct generated.\nwant %#v\ngot %#v", test.expectedFilters, *output)
+			}
+		})
+	}
+}
+
+func TestURLParsePresets(t *testing.T) {
+	presets := map[string]string{
+		"roku-legacy": "/v(hevc,dvh)/a(ec-3)/b(0,6000)/ct(stpp)",
+		"broken":      "/b(6000,0)",
+	}
+
+	tests := []struct {
+		name              string
+		input             string
+		query             string
+		expectedFilters   MediaFilters
+		expectedErr       bool
+		expectedErrorCode ParseErrorCode
+	}{
+		{
+			name:  "preset expands to its filters",
+			input: "/p(roku-legacy)/path/to/test.m3u8",
+			expectedFilters: MediaFilters{
+				Videos:       []VideoType{videoHEVC, "dvh"},
+				Audios:       []AudioType{"ec-3"},
+				CaptionTypes: []CaptionType{"stpp"},
+				MinBitrate:   0,
+				MaxBitrate:   6000,
+				Preset:       "roku-legacy",
+				Protocol:     ProtocolHLS,
+			},
+		},
+		{
+			name:  "filters given in the url override the ones of the preset",
+			input: "/p(roku-legacy)/v(+avc)/b(,3000)/al(es)/path/to/test.m3u8",
+			expectedFilters: MediaFilters{
+				KeepVideos:     []VideoType{videoH264},
+				Audios:         []AudioType{"ec-3"},
+				AudioLanguages: []AudioLanguage{"es"},
+				CaptionTypes:   []CaptionType{"stpp"},
+				MinBitrate:     0,
+				MaxBitrate:     3000,
+				Preset:         "roku-legacy",
+				Protocol:       ProtocolHLS,
+			},
+		},
+		{
+			name:  "preset given as a query parameter",
+			input: "/a(aac)/path/to/test.mpd",
+			query: "p=roku-legacy",
+			expectedFilters: MediaFilters{
+				Videos:       []VideoType{videoHEVC, "dvh"},
+				Audios:       []AudioType{audioAAC},
+				CaptionTypes: []CaptionType{"stpp"},
+				MinBitrate:   0,
+				MaxBitrate:   6000,
+				Preset:       "roku-legacy",
+				Protocol:     ProtocolDASH,
+			},
+		},
+		{
+			name:              "unknown preset throws a parse error",
+			input:             "/p(roku)/path/to/test.m3u8",
+			expectedErr:       true,
+			expectedErrorCode: UnknownPresetCode,
+		},
+		{
+			name:              "more than one preset throws a parse error",
+			input:             "/p(roku-legacy,broken)/path/to/test.m3u8",
+			expectedErr:       true,
+			expectedErrorCode: ValueCountCode,
+		},
+		{
+			name:        "malformed preset throws an error that is not a parse error",
+			input:       "/p(broken)/path/to/test.m3u8",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			_, output, err := URLParseWithQuery(test.input, test.query, presets)
+			if !test.expectedErr && err != nil {
+				t.Errorf("Did not expect an error returned, got: %v", err)
+				return
+			} else if test.expectedErr && err == nil {
+				t.Errorf("Expected an error returned, got nil")
+				return
+			}
+
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) != (test.expectedErrorCode != "") {
+				t.Errorf("wrong error type returned, got: %v", err)
+			} else if parseErr != nil && parseErr.Code != test.expectedErrorCode {
+				t.Errorf("wrong error code returned.\nwant %v\ngot %v", test.expectedErrorCode, parseErr.Code)
+			}
+
+			if !test.expectedErr && !reflect.DeepEqual(*output, test.expectedFilters) {
+				t.Errorf("wrong struct generated.\nwant %#v\ngot %#v", test.expectedFilters, *output)
+			}
+		})
+	}
+}
+
+func TestURLParseTrimTimes(t *testing.T) {
+	defer func(original func() time.Time) { now = original }(now)
+	now = func() time.Time { return time.Date(2020, 3, 11, 1, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name         string
+		input        string
+		expectedTrim *Trim
+		expectedErr  bool
+	}{
+		{
+			name:         "unix seconds",
+			input:        "/t(1583887920,1583887944)/path/to/test.m3u8",
+			expectedTrim: &Trim{Start: 1583887920, End: 1583887944},
+		},
+		{
+			name:         "iso-8601 timestamps",
+			input:        "/t(2020-03-11T00:52:00Z,2020-03-11T01:52:24+01:00)/path/to/test.m3u8",
+			expectedTrim: &Trim{Start: 1583887920, End: 1583887944},
+		},
+		{
+			name:         "iso-8601 timestamp and unix seconds",
+			input:        "/t(2020-03-11T00:52:00Z,1583887944)/path/to/test.m3u8",
+			expectedTrim: &Trim{Start: 1583887920, End: 1583887944},
+		},
+		{
+			name:         "iso-8601 durations are offsets from the start of the playlist",
+			input:        "/t(PT10M,PT1H2M3.5S)/path/to/test.m3u8",
+			expectedTrim: &Trim{Start: 600, End: 3723, Offset: true},
+		},
+		{
+			name:         "iso-8601 duration with offset seconds and a boundary",
+			input:        "/t(0,P1DT1S,offset,inside)/path/to/test.m3u8",
+			expectedTrim: &Trim{Start: 0, End: 86401, Offset: true, Boundary: TrimInside},
+		},
+		{
+			name:         "times relative to now",
+			input:        "/t(now-3600,now)/path/to/test.m3u8",
+			expectedTrim: &Trim{Start: 1583884800, End: 1583888400},
+		},
+		{
+			name:         "times relative to now with iso-8601 durations",
+			input:        "/t(now-PT1H,now+PT30M)/path/to/test.m3u8",
+			expectedTrim: &Trim{Start: 1583884800, End: 1583890200},
+		},
+		{
+			name:        "offsets mixed with absolute times throw error",
+			input:       "/t(PT10M,now)/path/to/test.m3u8",
+			expectedErr: true,
+		},
+		{
+			name:        "absolute times with the offset option throw error",
+			input:       "/t(2020-03-11T00:52:00Z,now,offset)/path/to/test.m3u8",
+			expectedErr: true,
+		},
+		{
+			name:        "malformed duration throws error",
+			input:       "/t(PT10X,PT20M)/path/to/test.m3u8",
+			expectedErr: true,
+		},
+		{
+			name:        "malformed timestamp throws error",
+			input:       "/t(2020-03-11,now)/path/to/test.m3u8",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			_, output, err := URLParse(test.input)
+			if !test.expectedErr && err != nil {
+				t.Errorf("Did not expect an error returned, got: %v", err)
+				return
+			} else if test.expectedErr && err == nil {
+				t.Errorf("Expected an error returned, got nil")
+				return
+			}
+
+			if !test.expectedErr && !reflect.DeepEqual(output.Trim, test.expectedTrim) {
+				t.Errorf("wrong trim generated.\nwant %#v\ngot %#v", test.expectedTrim, output.Trim)
+			}
+		})
+	}
+}